@@ -9,7 +9,9 @@ import (
 	"path/filepath"
 
 	"github.com/huyouba1/kde/pkg/api"
+	"github.com/huyouba1/kde/pkg/delivery"
 	"github.com/huyouba1/kde/pkg/storage"
+	"github.com/huyouba1/kde/pkg/storage/models"
 )
 
 var (
@@ -39,6 +41,18 @@ func main() {
 		log.Fatalf("加载配置文件失败: %v", err)
 	}
 
+	// 子命令
+	switch flag.Arg(0) {
+	case "":
+	case "rotate-key":
+		if err := rotateKey(configs.C()); err != nil {
+			log.Fatalf("轮换主密钥失败: %v", err)
+		}
+		return
+	default:
+		log.Fatalf("未知的子命令: %s", flag.Arg(0))
+	}
+
 	fmt.Println("Kubernetes管理系统服务启动中...")
 	// 创建并启动服务器
 	server, err := api.NewServer(configs.C())
@@ -57,3 +71,41 @@ func main() {
 		log.Fatalf("服务器启动失败: %v", err)
 	}
 }
+
+// rotateKey 生成新版本的主密钥，并使用新密钥重新加密所有加密字段
+// 主密钥来自环境变量时无法写回，需要先在环境变量中追加新版本密钥，此时只重新加密
+// 运行中的服务读取到新版本的密文或定期检查到密钥文件变化时会重新加载密钥文件；
+// 旧版本密钥仍保留在文件中，轮换期间服务以旧版本写入的数据仍可解密，可再次轮换重新加密
+func rotateKey(cfg *configs.Config) error {
+	keyring, err := storage.LoadKeyring(cfg.Database.Encryption)
+	if err != nil {
+		return err
+	}
+
+	if keyring.FromEnv() {
+		fmt.Printf("主密钥来自环境变量 %s，使用版本 %d 重新加密\n", cfg.Database.Encryption.KeyEnv, keyring.CurrentVersion())
+	} else {
+		version, err := storage.AddKeyVersion(cfg.Database.Encryption.KeyFile)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("已生成版本 %d 的主密钥: %s\n", version, cfg.Database.Encryption.KeyFile)
+	}
+
+	// 创建存储工厂时会重新加载主密钥
+	factory := storage.NewFactory(cfg)
+	defer factory.Close()
+	if err := factory.AutoMigrate(delivery.EncryptedModels()...); err != nil {
+		return err
+	}
+
+	count, err := factory.Reencrypt(append([]interface{}{&models.ClusterModel{}}, delivery.EncryptedModels()...)...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已重新加密 %d 条记录\n", count)
+	if keyring.FromEnv() {
+		fmt.Println("运行中的服务需要使用新的环境变量重启后才能加载新版本的主密钥")
+	}
+	return nil
+}
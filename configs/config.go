@@ -36,6 +36,8 @@ func NewDefaultConfig() *Config {
 	return &Config{
 		Server:   NewServerConfig(),
 		Database: NewDatabaseConfig(),
+		Cluster:  NewClusterConfig(),
+		Delivery: NewDeliveryConfig(),
 		Log:      NewLogConfig(),
 	}
 }
@@ -44,9 +46,10 @@ func NewDefaultConfig() *Config {
 type Config struct {
 	Server   *ServerConfig   `mapstructure:"server"`
 	Database *DatabaseConfig `mapstructure:"database"`
+	Cluster  *ClusterConfig  `mapstructure:"cluster"`
 	//Deploy     *DeployConfig     `mapstructure:"deploy"`
-	//Delivery   *DeliveryConfig   `mapstructure:"delivery"`
-	Log *LogConfig `mapstructure:"log"`
+	Delivery *DeliveryConfig `mapstructure:"delivery"`
+	Log      *LogConfig      `mapstructure:"log"`
 	//Auth       *AuthConfig       `mapstructure:"auth"`
 	//Kubernetes *KubernetesConfig `mapstructure:"kubernetes"`
 	//Cache      *CacheConfig      `mapstructure:"cache"`
@@ -63,6 +66,10 @@ func NewServerConfig() *ServerConfig {
 type ServerConfig struct {
 	Port int    `mapstructure:"port"`
 	Host string `mapstructure:"host"`
+	// AdminToken 下载kubeconfig等高权限操作使用的令牌，为空时禁用这些操作
+	AdminToken string `mapstructure:"adminToken"`
+	// AllowedOrigins 除同源外允许建立WebSocket连接的来源，例如前端开发服务器http://localhost:5173
+	AllowedOrigins []string `mapstructure:"allowedOrigins"`
 }
 
 func NewDatabaseConfig() *DatabaseConfig {
@@ -75,6 +82,10 @@ func NewDatabaseConfig() *DatabaseConfig {
 			Endpoints:   []string{"127.0.0.1:2379"},
 			DialTimeout: 5,
 		},
+		Encryption: EncryptionConfig{
+			KeyFile: "data/master.key",
+			KeyEnv:  "KDE_MASTER_KEY",
+		},
 	}
 }
 
@@ -120,7 +131,9 @@ type DatabaseConfig struct {
 	Type   string       `mapstructure:"type"`
 	SQLite SQLiteConfig `mapstructure:"sqlite"`
 	Etcd   EtcdConfig   `mapstructure:"etcd"`
-	lock   sync.Mutex
+	// Encryption 敏感字段加密配置
+	Encryption EncryptionConfig `mapstructure:"encryption"`
+	lock       sync.Mutex
 }
 
 // SQLiteConfig SQLite数据库配置
@@ -134,6 +147,15 @@ type EtcdConfig struct {
 	DialTimeout int      `mapstructure:"dialTimeout"`
 }
 
+// EncryptionConfig 敏感字段加密配置
+// 主密钥每行格式为 <版本>:<base64编码的32字节密钥>，最新版本用于加密
+type EncryptionConfig struct {
+	// KeyFile 主密钥文件，不存在时自动生成
+	KeyFile string `mapstructure:"keyFile"`
+	// KeyEnv 保存主密钥的环境变量，设置后优先于密钥文件，多个版本以逗号分隔
+	KeyEnv string `mapstructure:"keyEnv"`
+}
+
 // DeployConfig 部署配置
 type DeployConfig struct {
 	Ansible   AnsibleConfig   `mapstructure:"ansible"`
@@ -152,10 +174,47 @@ type ContainerConfig struct {
 	Namespace string `mapstructure:"namespace"`
 }
 
+func NewClusterConfig() *ClusterConfig {
+	return &ClusterConfig{
+		ProbeInterval:    30,
+		FailureThreshold: 3,
+		ResyncPeriod:     600,
+	}
+}
+
+// ClusterConfig 集群管理配置
+type ClusterConfig struct {
+	// ProbeInterval 集群健康检查间隔（秒），小于等于0时不检查
+	ProbeInterval int `mapstructure:"probeInterval"`
+	// FailureThreshold 连续检查失败多少次后丢弃缓存的客户端
+	FailureThreshold int `mapstructure:"failureThreshold"`
+	// ResyncPeriod 集群资源缓存的重新同步周期（秒）
+	ResyncPeriod int `mapstructure:"resyncPeriod"`
+}
+
+func NewDeliveryConfig() *DeliveryConfig {
+	return &DeliveryConfig{
+		Helm: HelmConfig{
+			RepoUrl:   "https://charts.helm.sh/stable",
+			CachePath: "data/helm-cache",
+		},
+		Workdir:            "data/workdir",
+		Workers:            4,
+		ClusterConcurrency: 2,
+		EventWindow:        120,
+	}
+}
+
 // DeliveryConfig 应用交付配置
 type DeliveryConfig struct {
 	Helm    HelmConfig `mapstructure:"helm"`
 	Workdir string     `mapstructure:"workdir"`
+	// Workers 同时执行的交付任务数上限
+	Workers int `mapstructure:"workers"`
+	// ClusterConcurrency 单个集群同时执行的交付任务数上限
+	ClusterConcurrency int `mapstructure:"clusterConcurrency"`
+	// EventWindow 交付结束后收集资源事件的时间窗口（秒），0表示不收集
+	EventWindow int `mapstructure:"eventWindow"`
 }
 
 // HelmConfig Helm配置
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/huyouba1/kde/pkg/delivery"
+)
+
+// listApplications 查询应用，支持按cluster_id和namespace过滤
+func (s *Server) listApplications(c *gin.Context) {
+	apps, err := s.deliveryManager.ListApplications(c.Request.Context(), c.Query("cluster_id"), c.Query("namespace"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"applications": apps})
+}
+
+// getApplication 获取应用详情
+func (s *Server) getApplication(c *gin.Context) {
+	app, err := s.deliveryManager.GetApplication(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondApplicationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, app)
+}
+
+// listApplicationRevisions 按版本号倒序查询应用的修订版本，不包含资源清单
+func (s *Server) listApplicationRevisions(c *gin.Context) {
+	revisions, err := s.deliveryManager.ListRevisions(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondApplicationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+// getApplicationRevision 获取应用的修订版本，包含渲染后的资源清单
+// 非管理员请求时资源清单中Secret的数据被屏蔽
+func (s *Server) getApplicationRevision(c *gin.Context) {
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil || revision <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的修订版本: %s", c.Param("revision"))})
+		return
+	}
+
+	rev, err := s.deliveryManager.GetRevision(c.Request.Context(), c.Param("id"), revision)
+	if err != nil {
+		respondApplicationError(c, err)
+		return
+	}
+	if !s.isAdmin(c) && rev.Manifests != "" {
+		if rev.Manifests, err = delivery.MaskManifests(rev.Manifests); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, rev)
+}
+
+// rollbackApplication 回滚应用到revision指定的修订版本，回滚作为新的修订版本异步执行
+func (s *Server) rollbackApplication(c *gin.Context) {
+	revision, err := parseIntQuery(c, "revision", 0)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if revision == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "revision 不能为空"})
+		return
+	}
+
+	task, err := s.deliveryManager.Rollback(c.Request.Context(), c.Param("id"), revision)
+	if err != nil {
+		respondApplicationError(c, err)
+		return
+	}
+	respondTaskAccepted(c, task)
+}
+
+// respondApplicationError 根据应用相关的错误类型返回对应的状态码
+func respondApplicationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, delivery.ErrApplicationNotFound), errors.Is(err, delivery.ErrRevisionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, delivery.ErrRevisionNotDeployed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, delivery.ErrIdempotencyKeyReused):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
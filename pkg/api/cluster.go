@@ -0,0 +1,313 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/huyouba1/kde/pkg/cluster"
+	"github.com/huyouba1/kde/pkg/storage/models"
+)
+
+// maxKubeconfigSize 上传kubeconfig文件大小上限
+const maxKubeconfigSize = 1 << 20
+
+// clusterRequest 注册或更新集群的请求
+// kubeconfig可以通过JSON字段提交，也可以通过multipart表单的kubeconfig文件上传
+type clusterRequest struct {
+	Name        string `json:"name" form:"name"`
+	Description string `json:"description" form:"description"`
+	KubeConfig  string `json:"kubeconfig" form:"kubeconfig"`
+}
+
+// importClusterRequest 导入kubeconfig的请求
+// 未指定contexts时只返回kubeconfig中的上下文列表，指定后将每个上下文注册为独立的集群
+type importClusterRequest struct {
+	KubeConfig  string   `json:"kubeconfig" form:"kubeconfig"`
+	Contexts    []string `json:"contexts" form:"contexts"`
+	Description string   `json:"description" form:"description"`
+}
+
+// listClusters 获取集群列表
+func (s *Server) listClusters(c *gin.Context) {
+	clusters, err := s.clusterManager.ListClusters(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"clusters": clusters,
+	})
+}
+
+// getCluster 获取集群详情
+func (s *Server) getCluster(c *gin.Context) {
+	target, err := s.clusterManager.GetCluster(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondClusterError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, target)
+}
+
+// createCluster 使用kubeconfig注册集群
+func (s *Server) createCluster(c *gin.Context) {
+	req, err := bindClusterRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "集群名称不能为空"})
+		return
+	}
+
+	target := &models.ClusterModel{
+		Name:        req.Name,
+		Description: req.Description,
+		KubeConfig:  req.KubeConfig,
+	}
+	if err := s.clusterManager.RegisterCluster(c.Request.Context(), target); err != nil {
+		respondClusterError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, target)
+}
+
+// updateCluster 更新集群名称、描述或kubeconfig
+func (s *Server) updateCluster(c *gin.Context) {
+	req, err := bindClusterRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	target, err := s.clusterManager.GetCluster(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondClusterError(c, err)
+		return
+	}
+
+	if req.Name != "" {
+		target.Name = req.Name
+	}
+	if req.Description != "" {
+		target.Description = req.Description
+	}
+
+	if req.KubeConfig != "" {
+		err = s.clusterManager.UpdateKubeConfig(c.Request.Context(), target, req.KubeConfig)
+	} else {
+		err = s.clusterManager.UpdateCluster(c.Request.Context(), target)
+	}
+	if err != nil {
+		respondClusterError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, target)
+}
+
+// deleteCluster 删除集群
+func (s *Server) deleteCluster(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := s.clusterManager.GetCluster(c.Request.Context(), id); err != nil {
+		respondClusterError(c, err)
+		return
+	}
+
+	if err := s.clusterManager.DeleteCluster(c.Request.Context(), id); err != nil {
+		respondClusterError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("集群 %s 已删除", id),
+	})
+}
+
+// importClusters 从包含多个上下文的kubeconfig导入集群
+func (s *Server) importClusters(c *gin.Context) {
+	var req importClusterRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的请求: %v", err)})
+		return
+	}
+	if isMultipartRequest(c) {
+		kubeconfig, err := readKubeconfigFile(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if kubeconfig != "" {
+			req.KubeConfig = kubeconfig
+		}
+	}
+	if req.KubeConfig == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kubeconfig不能为空"})
+		return
+	}
+
+	// 未选择上下文时返回可导入的上下文列表
+	if len(req.Contexts) == 0 {
+		contexts, err := cluster.ParseKubeconfig([]byte(req.KubeConfig))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"contexts": contexts,
+		})
+		return
+	}
+
+	results, err := s.clusterManager.ImportContexts(c.Request.Context(), []byte(req.KubeConfig), req.Contexts, req.Description)
+	if err != nil {
+		respondClusterError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results": results,
+	})
+}
+
+// getClusterHealth 获取集群的健康状态和最近的检查记录
+func (s *Server) getClusterHealth(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := s.clusterManager.GetCluster(c.Request.Context(), id); err != nil {
+		respondClusterError(c, err)
+		return
+	}
+
+	health, ok := s.clusterManager.GetClusterHealth(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "集群尚未进行健康检查"})
+		return
+	}
+
+	c.JSON(http.StatusOK, health)
+}
+
+// listClusterNodes 获取集群的节点清单，数据来自后台同步而不是实时查询集群
+func (s *Server) listClusterNodes(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := s.clusterManager.GetCluster(c.Request.Context(), id); err != nil {
+		respondClusterError(c, err)
+		return
+	}
+
+	nodes, err := s.clusterManager.ListNodes(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"nodes": nodes,
+	})
+}
+
+// downloadKubeconfig 下载集群的kubeconfig
+// 集群的其他接口不会返回kubeconfig，下载需要在Authorization头中携带管理员令牌
+func (s *Server) downloadKubeconfig(c *gin.Context) {
+	if !s.isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "下载kubeconfig需要管理员令牌"})
+		return
+	}
+
+	target, err := s.clusterManager.GetCluster(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondClusterError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", target.Name+".kubeconfig"))
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/yaml", []byte(target.KubeConfig))
+}
+
+// isAdmin 检查请求是否携带了管理员令牌，未配置令牌时总是返回false
+func (s *Server) isAdmin(c *gin.Context) bool {
+	return s.isAdminToken(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+}
+
+// isAdminToken 以固定时间比较令牌与管理员令牌，未配置令牌时总是返回false
+func (s *Server) isAdminToken(provided string) bool {
+	token := s.config.Server.AdminToken
+	if token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+// bindClusterRequest 解析JSON或multipart表单形式的集群请求
+func bindClusterRequest(c *gin.Context) (*clusterRequest, error) {
+	var req clusterRequest
+	if !isMultipartRequest(c) {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, fmt.Errorf("无效的请求: %v", err)
+		}
+		return &req, nil
+	}
+
+	if err := c.ShouldBind(&req); err != nil {
+		return nil, fmt.Errorf("无效的请求: %v", err)
+	}
+
+	// 优先使用上传的kubeconfig文件
+	kubeconfig, err := readKubeconfigFile(c)
+	if err != nil {
+		return nil, err
+	}
+	if kubeconfig != "" {
+		req.KubeConfig = kubeconfig
+	}
+
+	return &req, nil
+}
+
+// readKubeconfigFile 读取multipart表单中上传的kubeconfig文件，未上传时返回空字符串
+func readKubeconfigFile(c *gin.Context) (string, error) {
+	header, err := c.FormFile("kubeconfig")
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			return "", nil
+		}
+		return "", fmt.Errorf("读取kubeconfig文件失败: %v", err)
+	}
+	if header.Size > maxKubeconfigSize {
+		return "", fmt.Errorf("kubeconfig文件不能超过 %d 字节", maxKubeconfigSize)
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return "", fmt.Errorf("打开kubeconfig文件失败: %v", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("读取kubeconfig文件失败: %v", err)
+	}
+	return string(data), nil
+}
+
+// respondClusterError 根据错误类型返回集群相关的错误响应
+func respondClusterError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, cluster.ErrClusterNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, cluster.ErrConnectFailed):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,601 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/huyouba1/kde/pkg/cluster"
+	"github.com/huyouba1/kde/pkg/delivery"
+)
+
+const (
+	// idempotencyKeyHeader 幂等键请求头
+	idempotencyKeyHeader = "Idempotency-Key"
+	// maxIdempotencyKeyLength 幂等键最大长度
+	maxIdempotencyKeyLength = 255
+	// sseHeartbeatInterval SSE心跳间隔，防止代理断开空闲连接
+	sseHeartbeatInterval = 15 * time.Second
+	// maxUploadSize 上传文件大小上限
+	maxUploadSize = 32 << 20
+)
+
+// taskLogMessage 通过WebSocket推送的任务日志消息
+type taskLogMessage struct {
+	// Type 消息类型：log为日志，end为任务结束
+	Type string                 `json:"type"`
+	Log  *delivery.TaskLog      `json:"log,omitempty"`
+	Task *delivery.DeliveryTask `json:"task,omitempty"`
+}
+
+// idempotencyKeyMiddleware 将Idempotency-Key请求头传递给交付管理器
+func idempotencyKeyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("%s 长度不能超过 %d", idempotencyKeyHeader, maxIdempotencyKeyLength),
+			})
+			return
+		}
+
+		c.Request = c.Request.WithContext(delivery.WithIdempotencyKey(c.Request.Context(), key))
+		c.Next()
+	}
+}
+
+// deployYaml 提交YAML部署，支持JSON请求或上传YAML文件/tar.gz包
+func (s *Server) deployYaml(c *gin.Context) {
+	options, ok := s.bindYAMLOptions(c)
+	if !ok {
+		return
+	}
+
+	task, err := s.deliveryManager.DeployYAML(c.Request.Context(), options)
+	if err != nil {
+		respondSubmitError(c, err)
+		return
+	}
+	respondTaskAccepted(c, task)
+}
+
+// deployHelm 提交Helm部署
+func (s *Server) deployHelm(c *gin.Context) {
+	options, ok := s.bindHelmOptions(c)
+	if !ok {
+		return
+	}
+
+	task, err := s.deliveryManager.DeployHelm(c.Request.Context(), options)
+	if err != nil {
+		respondSubmitError(c, err)
+		return
+	}
+	respondTaskAccepted(c, task)
+}
+
+// deployKustomize 提交Kustomize部署，支持JSON请求或上传tar.gz包
+// 上传交付包时base_path和overlay_path为交付包内的相对路径，JSON请求时为交付工作目录下的相对路径
+func (s *Server) deployKustomize(c *gin.Context) {
+	options, ok := s.bindKustomizeOptions(c)
+	if !ok {
+		return
+	}
+
+	task, err := s.deliveryManager.DeployKustomize(c.Request.Context(), options)
+	if err != nil {
+		respondSubmitError(c, err)
+		return
+	}
+	respondTaskAccepted(c, task)
+}
+
+// previewDelivery 预览部署对集群的变化，请求体与对应类型的部署接口相同
+// 资源以试运行方式服务端应用，返回每个资源当前状态与试运行结果的差异
+func (s *Server) previewDelivery(c *gin.Context) {
+	var diffs []*delivery.ObjectDiff
+	var err error
+	switch deliveryType := delivery.DeliveryType(c.Query("type")); deliveryType {
+	case delivery.TypeYAML:
+		options, ok := s.bindYAMLOptions(c)
+		if !ok {
+			return
+		}
+		diffs, err = s.deliveryManager.PreviewYAML(c.Request.Context(), options)
+	case delivery.TypeHelm:
+		options, ok := s.bindHelmOptions(c)
+		if !ok {
+			return
+		}
+		diffs, err = s.deliveryManager.PreviewHelm(c.Request.Context(), options)
+	case delivery.TypeKustomize:
+		options, ok := s.bindKustomizeOptions(c)
+		if !ok {
+			return
+		}
+		diffs, err = s.deliveryManager.PreviewKustomize(c.Request.Context(), options)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的交付类型: %q", deliveryType)})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"objects": diffs})
+}
+
+// bindYAMLOptions 解析并校验YAML部署选项，失败时已写入响应
+func (s *Server) bindYAMLOptions(c *gin.Context) (*delivery.YAMLOptions, bool) {
+	var options delivery.YAMLOptions
+	if isMultipartRequest(c) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
+		if err := c.ShouldBind(&options); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的请求: %v", err)})
+			return nil, false
+		}
+		data, filename, err := readUploadedFile(c, "file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		if options.Content, err = delivery.ReadManifests(data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		options.FilePath = filename
+	} else if err := c.ShouldBindJSON(&options); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的请求: %v", err)})
+		return nil, false
+	}
+
+	if err := options.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if !s.resolveDeliveryCluster(c, options.ClusterID, &options.ClusterName) {
+		return nil, false
+	}
+	return &options, true
+}
+
+// bindHelmOptions 解析并校验Helm部署选项，chart_path为交付工作目录下的相对路径，失败时已写入响应
+func (s *Server) bindHelmOptions(c *gin.Context) (*delivery.HelmOptions, bool) {
+	var options delivery.HelmOptions
+	if err := c.ShouldBindJSON(&options); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的请求: %v", err)})
+		return nil, false
+	}
+
+	if err := options.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if options.ChartPath != "" {
+		var err error
+		if options.ChartPath, err = s.deliveryManager.WorkdirPath(options.ChartPath); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, false
+		}
+	}
+	if !s.resolveDeliveryCluster(c, options.ClusterID, &options.ClusterName) {
+		return nil, false
+	}
+	return &options, true
+}
+
+// bindKustomizeOptions 解析并校验Kustomize部署选项，失败时已写入响应
+// 上传交付包时路径为交付包内的相对路径，交付包在校验通过后解压；JSON请求的路径为交付工作目录下的相对路径
+func (s *Server) bindKustomizeOptions(c *gin.Context) (*delivery.KustomizeOptions, bool) {
+	var options delivery.KustomizeOptions
+	var data []byte
+	if isMultipartRequest(c) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
+		if err := c.ShouldBind(&options); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的请求: %v", err)})
+			return nil, false
+		}
+		var err error
+		if data, _, err = readUploadedFile(c, "file"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, false
+		}
+	} else if err := c.ShouldBindJSON(&options); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的请求: %v", err)})
+		return nil, false
+	}
+
+	if err := options.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if !s.resolveDeliveryCluster(c, options.ClusterID, &options.ClusterName) {
+		return nil, false
+	}
+
+	var err error
+	if data != nil {
+		err = s.extractKustomizeBundle(data, &options)
+	} else {
+		err = s.resolveKustomizePaths(&options)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &options, true
+}
+
+// resolveKustomizePaths 将JSON请求中的路径解析为交付工作目录下的路径
+func (s *Server) resolveKustomizePaths(options *delivery.KustomizeOptions) error {
+	var err error
+	if options.BasePath, err = s.deliveryManager.WorkdirPath(options.BasePath); err != nil {
+		return err
+	}
+	if options.OverlayPath != "" {
+		if options.OverlayPath, err = s.deliveryManager.WorkdirPath(options.OverlayPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractKustomizeBundle 解压Kustomize交付包，并将选项中的路径解析为解压后的路径
+// 解压目录记录在选项中，由交付管理器在任务结束或预览返回后删除
+func (s *Server) extractKustomizeBundle(data []byte, options *delivery.KustomizeOptions) error {
+	dir, err := s.deliveryManager.ExtractBundle(data)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	options.BundleDir, options.BundleDigest = dir, hex.EncodeToString(sum[:])
+
+	if options.BasePath, err = delivery.BundlePath(dir, options.BasePath); err != nil {
+		s.deliveryManager.RemoveBundle(dir)
+		return err
+	}
+	if options.OverlayPath != "" {
+		if options.OverlayPath, err = delivery.BundlePath(dir, options.OverlayPath); err != nil {
+			s.deliveryManager.RemoveBundle(dir)
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveDeliveryCluster 校验目标集群存在并填充集群名称，失败时已写入响应
+func (s *Server) resolveDeliveryCluster(c *gin.Context, clusterID string, clusterName *string) bool {
+	target, err := s.clusterManager.GetCluster(c.Request.Context(), clusterID)
+	if err != nil {
+		if errors.Is(err, cluster.ErrClusterNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("集群 %s 不存在", clusterID)})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+
+	*clusterName = target.Name
+	return true
+}
+
+// respondSubmitError 返回提交交付任务失败的响应，幂等键被不同请求重复使用时返回422
+func respondSubmitError(c *gin.Context, err error) {
+	if errors.Is(err, delivery.ErrIdempotencyKeyReused) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// respondTaskAccepted 返回202和任务详情，Location指向任务查询地址
+func respondTaskAccepted(c *gin.Context, task *delivery.DeliveryTask) {
+	c.Header("Location", "/api/v1/delivery/tasks/"+task.ID)
+	c.JSON(http.StatusAccepted, task)
+}
+
+// isMultipartRequest 判断是否为文件上传请求
+func isMultipartRequest(c *gin.Context) bool {
+	return strings.HasPrefix(c.ContentType(), "multipart/form-data")
+}
+
+// readUploadedFile 读取上传的文件内容
+func readUploadedFile(c *gin.Context, field string) ([]byte, string, error) {
+	header, err := c.FormFile(field)
+	if err != nil {
+		return nil, "", fmt.Errorf("缺少上传文件 %s: %v", field, err)
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, "", fmt.Errorf("打开上传文件失败: %v", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("读取上传文件失败: %v", err)
+	}
+	return data, header.Filename, nil
+}
+
+// listDeliveryTasks 查询交付任务历史
+func (s *Server) listDeliveryTasks(c *gin.Context) {
+	filter := &delivery.TaskFilter{
+		ClusterID: c.Query("cluster_id"),
+		Namespace: c.Query("namespace"),
+		Type:      delivery.DeliveryType(c.Query("type")),
+		Status:    delivery.DeliveryStatus(c.Query("status")),
+	}
+
+	var err error
+	if filter.Since, err = parseTimeQuery(c, "since"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.Until, err = parseTimeQuery(c, "until"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 分页大小不大于0时使用默认值，超过上限时按上限返回
+	if filter.Limit, err = parseIntQuery(c, "limit", delivery.DefaultTaskPageSize); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.Offset, err = parseIntQuery(c, "offset", 0); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tasks, total, err := s.deliveryManager.ListTasks(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tasks": tasks,
+		"total": total,
+	})
+}
+
+// getDeliveryTask 获取交付任务详情
+func (s *Server) getDeliveryTask(c *gin.Context) {
+	task, err := s.deliveryManager.GetTask(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondTaskError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, task)
+}
+
+// cancelDeliveryTask 取消交付任务，任务已结束时返回200，执行器仍在退出时返回202和当前状态
+func (s *Server) cancelDeliveryTask(c *gin.Context) {
+	task, err := s.deliveryManager.CancelTask(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, delivery.ErrTaskNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, delivery.ErrTaskNotCancellable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if !task.Status.Finished() {
+		c.JSON(http.StatusAccepted, task)
+		return
+	}
+	c.JSON(http.StatusOK, task)
+}
+
+// getDeliveryTaskLogs 获取交付任务日志，follow=true时通过SSE实时推送直到任务结束
+func (s *Server) getDeliveryTaskLogs(c *gin.Context) {
+	taskID := c.Param("id")
+	afterID, err := parseLastLogID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("follow") != "true" {
+		if _, err := s.deliveryManager.GetTask(c.Request.Context(), taskID); err != nil {
+			respondTaskError(c, err)
+			return
+		}
+		logs, err := s.deliveryManager.ListTaskLogs(c.Request.Context(), taskID, afterID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"logs": logs})
+		return
+	}
+
+	logs, err := s.deliveryManager.FollowTaskLogs(c.Request.Context(), taskID, afterID)
+	if err != nil {
+		respondTaskError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case entry, ok := <-logs:
+			if !ok {
+				// 任务结束，推送最终状态
+				if task, err := s.deliveryManager.GetTask(c.Request.Context(), taskID); err == nil {
+					c.Render(-1, sse.Event{Event: "end", Data: task})
+				}
+				return false
+			}
+			c.Render(-1, sse.Event{
+				Id:    strconv.FormatUint(uint64(entry.ID), 10),
+				Event: "log",
+				Data:  entry,
+			})
+			return true
+		case <-heartbeat.C:
+			c.Render(-1, sse.Event{Event: "ping", Data: time.Now().Unix()})
+			return true
+		}
+	})
+}
+
+// watchDeliveryTaskLogs 通过WebSocket实时推送交付任务日志
+func (s *Server) watchDeliveryTaskLogs(c *gin.Context) {
+	taskID := c.Param("id")
+	afterID, err := parseLastLogID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	logs, err := s.deliveryManager.FollowTaskLogs(ctx, taskID, afterID)
+	if err != nil {
+		respondTaskError(c, err)
+		return
+	}
+
+	conn, err := s.logUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// 升级失败时Upgrader已返回错误响应
+		return
+	}
+	defer conn.Close()
+
+	// 读取客户端消息以感知连接关闭
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for entry := range logs {
+		if err := conn.WriteJSON(taskLogMessage{Type: "log", Log: entry}); err != nil {
+			return
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	// 任务结束，推送最终状态后关闭连接
+	if task, err := s.deliveryManager.GetTask(ctx, taskID); err == nil {
+		conn.WriteJSON(taskLogMessage{Type: "end", Task: task})
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+// getDeliveryTaskEvents 获取交付任务关联的Kubernetes事件
+func (s *Server) getDeliveryTaskEvents(c *gin.Context) {
+	events, err := s.deliveryManager.ListTaskEvents(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+// getDeliveryInventory 获取应用最近一次交付的资源清单
+func (s *Server) getDeliveryInventory(c *gin.Context) {
+	clusterID, name := c.Query("cluster_id"), c.Query("name")
+	if clusterID == "" || name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cluster_id 和 name 不能为空"})
+		return
+	}
+
+	inventory, err := s.deliveryManager.GetInventory(c.Request.Context(), clusterID, c.Query("namespace"), name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if inventory == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "资源清单不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, inventory)
+}
+
+// respondTaskError 根据错误类型返回交付任务相关的错误响应
+func respondTaskError(c *gin.Context, err error) {
+	if errors.Is(err, delivery.ErrTaskNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// parseLastLogID 获取客户端已收到的最后一条日志ID，支持SSE重连时的Last-Event-ID请求头
+func parseLastLogID(c *gin.Context) (uint, error) {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("after")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无效的日志ID: %s", value)
+	}
+	return uint(id), nil
+}
+
+// parseTimeQuery 解析RFC3339格式的时间查询参数
+func parseTimeQuery(c *gin.Context, key string) (time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("无效的时间参数 %s: %v", key, err)
+	}
+	return t, nil
+}
+
+// parseIntQuery 解析非负整数查询参数
+func parseIntQuery(c *gin.Context, key string, defaultValue int) (int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无效的整数参数 %s: %s", key, value)
+	}
+	return n, nil
+}
@@ -1,66 +0,0 @@
-package handlers
-
-import (
-	"net/http"
-	"time"
-
-	"github.com/gin-gonic/gin"
-)
-
-// Cluster 表示一个 Kubernetes 集群
-type Cluster struct {
-	ID        string    `json:"id"`
-	Status    string    `json:"status"`
-	NodeCount int       `json:"nodeCount"`
-	CreatedAt time.Time `json:"createdAt"`
-}
-
-// GetClusters 获取所有集群
-func GetClusters(c *gin.Context) {
-	// TODO: 从数据库或配置中获取实际的集群信息
-	// 这里先返回模拟数据
-	clusters := []Cluster{
-		{
-			ID:        "cluster-1",
-			Status:    "Running",
-			NodeCount: 3,
-			CreatedAt: time.Now().Add(-24 * time.Hour),
-		},
-		{
-			ID:        "cluster-2",
-			Status:    "Creating",
-			NodeCount: 1,
-			CreatedAt: time.Now().Add(-1 * time.Hour),
-		},
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"clusters": clusters,
-	})
-}
-
-// CreateCluster 创建新集群
-func CreateCluster(c *gin.Context) {
-	// TODO: 实现实际的集群创建逻辑
-	// 这里返回成功消息
-	c.JSON(http.StatusOK, gin.H{
-		"message": "集群创建请求已提交",
-	})
-}
-
-// DeleteCluster 删除集群
-func DeleteCluster(c *gin.Context) {
-	id := c.Param("id")
-	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "集群ID不能为空",
-		})
-		return
-	}
-
-	// TODO: 实现实际的集群删除逻辑
-	// 这里返回成功消息
-	c.JSON(http.StatusOK, gin.H{
-		"message": "集群删除请求已提交",
-	})
-}
@@ -0,0 +1,366 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/huyouba1/kde/pkg/storage/models"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// defaultExecCommand 未指定命令时exec执行的命令
+var defaultExecCommand = []string{"/bin/sh"}
+
+// execMessage exec WebSocket上传递的消息
+type execMessage struct {
+	// Type 消息类型：客户端发送stdin、resize，服务端发送stdout、stderr、exit
+	Type string `json:"type"`
+	Data string `json:"data,omitempty"`
+	Cols uint16 `json:"cols,omitempty"`
+	Rows uint16 `json:"rows,omitempty"`
+}
+
+// streamPodLogs 通过SSE推送Pod日志
+func (s *Server) streamPodLogs(c *gin.Context) {
+	id, namespace, pod := c.Param("id"), c.Param("ns"), c.Param("pod")
+	if _, err := s.clusterManager.GetCluster(c.Request.Context(), id); err != nil {
+		respondClusterError(c, err)
+		return
+	}
+
+	opts, err := parsePodLogOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	client, err := s.clusterManager.GetClient(id)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry := s.audit(c, "pod.logs", id, namespace, "pods/"+pod, opts)
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	stream, err := client.StreamPodLogs(ctx, namespace, pod, opts)
+	if err != nil {
+		s.finishAudit(entry, err)
+		respondKubernetesError(c, err)
+		return
+	}
+	defer stream.Close()
+
+	lines, errs := readLines(ctx, stream)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	var streamErr error
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				streamErr = <-errs
+				end := gin.H{}
+				if streamErr != nil {
+					end["error"] = streamErr.Error()
+				}
+				c.Render(-1, sse.Event{Event: "end", Data: end})
+				return false
+			}
+			c.Render(-1, sse.Event{Event: "log", Data: line})
+			return true
+		case <-heartbeat.C:
+			c.Render(-1, sse.Event{Event: "ping", Data: time.Now().Unix()})
+			return true
+		}
+	})
+	s.finishAudit(entry, streamErr)
+}
+
+// execPod 通过WebSocket在Pod中执行命令，需要在Authorization头中携带管理员令牌
+// 浏览器无法设置请求头，可以同时请求kde.exec.v1和base64url.bearer.kde.<base64url编码的令牌>两个子协议
+func (s *Server) execPod(c *gin.Context) {
+	if !s.isAdmin(c) && !s.isAdminToken(subprotocolToken(c.Request)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "在Pod中执行命令需要管理员令牌"})
+		return
+	}
+
+	id, namespace, pod := c.Param("id"), c.Param("ns"), c.Param("pod")
+	if _, err := s.clusterManager.GetCluster(c.Request.Context(), id); err != nil {
+		respondClusterError(c, err)
+		return
+	}
+
+	tty, _ := strconv.ParseBool(c.Query("tty"))
+	command := c.QueryArray("command")
+	if len(command) == 0 {
+		command = defaultExecCommand
+	}
+	opts := &corev1.PodExecOptions{
+		Container: c.Query("container"),
+		Command:   command,
+		Stdin:     true,
+		Stdout:    true,
+		Stderr:    !tty,
+		TTY:       tty,
+	}
+
+	client, err := s.clusterManager.GetClient(id)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	conn, err := s.execUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// 升级失败时Upgrader已返回错误响应
+		return
+	}
+	defer conn.Close()
+
+	entry := s.audit(c, "pod.exec", id, namespace, "pods/"+pod, opts)
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	session := newExecSession(conn)
+	go func() {
+		defer cancel()
+		session.readLoop()
+	}()
+
+	streams := remotecommand.StreamOptions{
+		Stdin:  session.stdin,
+		Stdout: session.writer("stdout"),
+		Tty:    tty,
+	}
+	if tty {
+		streams.TerminalSizeQueue = session
+	} else {
+		streams.Stderr = session.writer("stderr")
+	}
+
+	execErr := client.ExecInPod(ctx, namespace, pod, opts, streams)
+	s.finishAudit(entry, execErr)
+
+	exit := execMessage{Type: "exit"}
+	if execErr != nil {
+		exit.Data = execErr.Error()
+	}
+	session.send(exit)
+	session.close()
+}
+
+// execSession 将WebSocket连接桥接为remotecommand的标准输入输出
+type execSession struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	stdin      *io.PipeReader
+	stdinInput *io.PipeWriter
+	sizes      chan remotecommand.TerminalSize
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// newExecSession 创建exec会话
+func newExecSession(conn *websocket.Conn) *execSession {
+	stdin, stdinInput := io.Pipe()
+	return &execSession{
+		conn:       conn,
+		stdin:      stdin,
+		stdinInput: stdinInput,
+		sizes:      make(chan remotecommand.TerminalSize, 1),
+		done:       make(chan struct{}),
+	}
+}
+
+// readLoop 读取客户端消息，直到连接关闭
+func (e *execSession) readLoop() {
+	defer e.stdinInput.Close()
+
+	for {
+		_, data, err := e.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var msg execMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		switch msg.Type {
+		case "stdin":
+			if _, err := e.stdinInput.Write([]byte(msg.Data)); err != nil {
+				return
+			}
+		case "resize":
+			// 只保留最新的终端大小
+			select {
+			case <-e.sizes:
+			default:
+			}
+			e.sizes <- remotecommand.TerminalSize{Width: msg.Cols, Height: msg.Rows}
+		}
+	}
+}
+
+// Next 返回下一个终端大小，实现remotecommand.TerminalSizeQueue
+func (e *execSession) Next() *remotecommand.TerminalSize {
+	select {
+	case size := <-e.sizes:
+		return &size
+	case <-e.done:
+		return nil
+	}
+}
+
+// writer 返回将输出转发为指定类型消息的Writer
+func (e *execSession) writer(msgType string) io.Writer {
+	return execWriter{session: e, msgType: msgType}
+}
+
+// send 发送消息，stdout和stderr可能并发写入
+func (e *execSession) send(msg execMessage) error {
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+	return e.conn.WriteJSON(msg)
+}
+
+// close 结束会话并关闭WebSocket连接
+func (e *execSession) close() {
+	e.closeOnce.Do(func() {
+		close(e.done)
+		e.stdin.Close()
+
+		e.writeMu.Lock()
+		defer e.writeMu.Unlock()
+		e.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	})
+}
+
+// execWriter 将命令输出写入WebSocket
+type execWriter struct {
+	session *execSession
+	msgType string
+}
+
+// Write 实现io.Writer
+func (w execWriter) Write(p []byte) (int, error) {
+	if err := w.session.send(execMessage{Type: w.msgType, Data: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// parsePodLogOptions 解析Pod日志参数
+func parsePodLogOptions(c *gin.Context) (*corev1.PodLogOptions, error) {
+	opts := &corev1.PodLogOptions{
+		Container: c.Query("container"),
+	}
+
+	var err error
+	if value := c.Query("follow"); value != "" {
+		if opts.Follow, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("无效的follow参数: %s", value)
+		}
+	}
+	if value := c.Query("previous"); value != "" {
+		if opts.Previous, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("无效的previous参数: %s", value)
+		}
+	}
+	if value := c.Query("tailLines"); value != "" {
+		lines, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || lines < 0 {
+			return nil, fmt.Errorf("无效的tailLines参数: %s", value)
+		}
+		opts.TailLines = &lines
+	}
+	if value := c.Query("sinceSeconds"); value != "" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("无效的sinceSeconds参数: %s", value)
+		}
+		opts.SinceSeconds = &seconds
+	}
+
+	return opts, nil
+}
+
+// readLines 按行读取日志流，读取结束后关闭lines并在errs中返回错误
+func readLines(ctx context.Context, r io.Reader) (<-chan string, <-chan error) {
+	lines := make(chan string)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(lines)
+
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+		errs <- scanner.Err()
+	}()
+
+	return lines, errs
+}
+
+// audit 记录直接访问集群的操作，审计日志写入失败不影响操作本身
+func (s *Server) audit(c *gin.Context, action, clusterID, namespace, resource string, detail interface{}) *models.AuditLog {
+	entry := &models.AuditLog{
+		Action:     action,
+		ClusterID:  clusterID,
+		Namespace:  namespace,
+		Resource:   resource,
+		RemoteAddr: c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		Result:     models.AuditStarted,
+	}
+	if detail != nil {
+		if data, err := json.Marshal(detail); err == nil {
+			entry.Detail = string(data)
+		}
+	}
+
+	if err := s.db.CreateAuditLog(entry); err != nil {
+		fmt.Printf("记录审计日志失败: %v\n", err)
+	}
+	return entry
+}
+
+// finishAudit 记录操作结果
+func (s *Server) finishAudit(entry *models.AuditLog, opErr error) {
+	if entry.ID == 0 {
+		return
+	}
+	if err := s.db.FinishAuditLog(entry, opErr); err != nil {
+		fmt.Printf("记录审计日志失败: %v\n", err)
+	}
+}
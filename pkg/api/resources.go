@@ -0,0 +1,187 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/huyouba1/kde/pkg/delivery"
+	"github.com/huyouba1/kde/pkg/k8s"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// coreGroupName 路径中表示核心API组的名称
+	coreGroupName = "core"
+	// defaultResourcePageSize 资源列表默认每页条数
+	defaultResourcePageSize = 100
+	// maxResourcePageSize 资源列表每页条数上限
+	maxResourcePageSize = 500
+)
+
+// listClusterResources 列出集群中的资源，支持命名空间、标签和字段选择器以及continue分页
+// Secret的数据仅对携带管理员令牌的请求返回明文
+func (s *Server) listClusterResources(c *gin.Context) {
+	resource, ok := s.resourceInterface(c)
+	if !ok {
+		return
+	}
+
+	limit, err := parseIntQuery(c, "limit", defaultResourcePageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if limit == 0 || limit > maxResourcePageSize {
+		limit = maxResourcePageSize
+	}
+
+	list, err := resource.List(c.Request.Context(), metav1.ListOptions{
+		LabelSelector: c.Query("labelSelector"),
+		FieldSelector: c.Query("fieldSelector"),
+		Limit:         int64(limit),
+		Continue:      c.Query("continue"),
+	})
+	if err != nil {
+		respondKubernetesError(c, err)
+		return
+	}
+
+	if !showManagedFields(c) {
+		for i := range list.Items {
+			list.Items[i].SetManagedFields(nil)
+		}
+	}
+	if !s.isAdmin(c) {
+		for i := range list.Items {
+			maskSecret(&list.Items[i])
+		}
+	}
+
+	respondObject(c, list.UnstructuredContent())
+}
+
+// getClusterResource 获取集群中的单个资源，Secret的数据仅对管理员返回明文
+func (s *Server) getClusterResource(c *gin.Context) {
+	resource, ok := s.resourceInterface(c)
+	if !ok {
+		return
+	}
+
+	obj, err := resource.Get(c.Request.Context(), c.Param("name"), metav1.GetOptions{})
+	if err != nil {
+		respondKubernetesError(c, err)
+		return
+	}
+
+	if !showManagedFields(c) {
+		obj.SetManagedFields(nil)
+	}
+	if !s.isAdmin(c) {
+		maskSecret(obj)
+	}
+
+	respondObject(c, obj.UnstructuredContent())
+}
+
+// resourceInterface 根据路径中的group、version和resource创建dynamic客户端，失败时已写入错误响应
+func (s *Server) resourceInterface(c *gin.Context) (dynamic.ResourceInterface, bool) {
+	id := c.Param("id")
+	if _, err := s.clusterManager.GetCluster(c.Request.Context(), id); err != nil {
+		respondClusterError(c, err)
+		return nil, false
+	}
+
+	client, err := s.clusterManager.GetClient(id)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	gvr := schema.GroupVersionResource{
+		Group:    c.Param("group"),
+		Version:  c.Param("version"),
+		Resource: c.Param("resource"),
+	}
+	if gvr.Group == coreGroupName {
+		gvr.Group = ""
+	}
+
+	mapping, err := client.ResolveResource(gvr)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+
+	return namespacedResource(c, client, mapping)
+}
+
+// namespacedResource 按资源作用域和namespace参数创建dynamic客户端
+func namespacedResource(c *gin.Context, client *k8s.Client, mapping *meta.RESTMapping) (dynamic.ResourceInterface, bool) {
+	resource := client.GetDynamicClient().Resource(mapping.Resource)
+	namespace := c.Query("namespace")
+
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		if namespace != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "集群级资源不能指定namespace: " + mapping.Resource.Resource})
+			return nil, false
+		}
+		return resource, true
+	}
+
+	// 未指定namespace时列出所有命名空间的资源
+	return resource.Namespace(namespace), true
+}
+
+// showManagedFields 是否返回metadata.managedFields，默认不返回
+func showManagedFields(c *gin.Context) bool {
+	show, _ := strconv.ParseBool(c.Query("showManagedFields"))
+	return show
+}
+
+// maskSecret 屏蔽Secret的数据，只有携带管理员令牌的请求才能读取明文
+func maskSecret(obj *unstructured.Unstructured) {
+	if gk := obj.GroupVersionKind().GroupKind(); gk.Group == "" && gk.Kind == "Secret" {
+		delivery.MaskSecretData(obj, nil)
+	}
+}
+
+// respondObject 按format参数或Accept头返回JSON或YAML
+func respondObject(c *gin.Context, content map[string]interface{}) {
+	if c.Query("format") != "yaml" && !strings.Contains(c.GetHeader("Accept"), "yaml") {
+		c.JSON(http.StatusOK, content)
+		return
+	}
+
+	data, err := yaml.Marshal(content)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/yaml", data)
+}
+
+// respondKubernetesError 按API Server返回的状态码返回错误
+func respondKubernetesError(c *gin.Context, err error) {
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Code != 0 {
+		c.JSON(int(status.Status().Code), gin.H{
+			"error":  err.Error(),
+			"reason": status.Status().Reason,
+		})
+		return
+	}
+	c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+}
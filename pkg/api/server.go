@@ -8,7 +8,13 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/huyouba1/kde/pkg/api/handler"
+	"github.com/huyouba1/kde/pkg/cluster"
+	"github.com/huyouba1/kde/pkg/delivery"
+	deliveryhelm "github.com/huyouba1/kde/pkg/delivery/helm"
+	deliverykustomize "github.com/huyouba1/kde/pkg/delivery/kustomize"
+	deliveryyaml "github.com/huyouba1/kde/pkg/delivery/yaml"
 	"github.com/huyouba1/kde/pkg/storage"
 	"github.com/huyouba1/kde/pkg/storage/models"
 )
@@ -20,6 +26,13 @@ type Server struct {
 	httpServer      *http.Server
 	storageFactory  *storage.Factory
 	templateHandler *handler.TemplateHandler
+	db              *storage.DB
+	clusterManager  *cluster.ClusterManager
+	deliveryManager *delivery.Manager
+	// execUpgrader Pod终端使用的WebSocket升级器
+	execUpgrader *websocket.Upgrader
+	// logUpgrader 任务日志使用的WebSocket升级器
+	logUpgrader *websocket.Upgrader
 }
 
 // NewServer 创建一个新的API服务器
@@ -37,6 +50,27 @@ func NewServer(cfg *configs.Config) (*Server, error) {
 		return nil, fmt.Errorf("failed to create template handler: %w", err)
 	}
 
+	// 创建集群管理器
+	db := storage.WrapDB(storageFactory.GetDB())
+	clusterManager := cluster.NewClusterManager(db, cfg.Cluster)
+
+	// 创建交付管理器并注册各交付后端
+	deliveryManager, err := delivery.NewManager(*storageFactory, cfg.Delivery, clusterManager)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create delivery manager: %w", err)
+	}
+	credentials := deliveryManager.Credentials()
+	executors := []delivery.Executor{
+		deliveryyaml.NewManager(cfg.Delivery.Workdir, credentials),
+		deliveryhelm.NewManager(cfg.Delivery.Workdir, cfg.Delivery.Helm.CachePath, credentials),
+		deliverykustomize.NewManager(cfg.Delivery.Workdir, credentials),
+	}
+	for _, executor := range executors {
+		if err := deliveryManager.RegisterExecutor(executor); err != nil {
+			return nil, fmt.Errorf("failed to register delivery executor: %w", err)
+		}
+	}
+
 	// 设置静态文件服务
 	router.Static("/static", "pkg/api/handler/static")
 
@@ -49,6 +83,11 @@ func NewServer(cfg *configs.Config) (*Server, error) {
 		router:          router,
 		storageFactory:  storageFactory,
 		templateHandler: templateHandler,
+		db:              db,
+		clusterManager:  clusterManager,
+		deliveryManager: deliveryManager,
+		execUpgrader:    newWSUpgrader(cfg.Server.AllowedOrigins, execSubprotocol),
+		logUpgrader:     newWSUpgrader(cfg.Server.AllowedOrigins),
 	}
 
 	// 初始化路由
@@ -79,9 +118,21 @@ func (s *Server) initRoutes() {
 	{
 		cluster.GET("/", s.listClusters)
 		cluster.POST("/", s.createCluster)
+		cluster.POST("/import", s.importClusters)
 		cluster.GET("/:id", s.getCluster)
 		cluster.PUT("/:id", s.updateCluster)
 		cluster.DELETE("/:id", s.deleteCluster)
+		cluster.GET("/:id/kubeconfig", s.downloadKubeconfig)
+		cluster.GET("/:id/health", s.getClusterHealth)
+		cluster.GET("/:id/nodes", s.listClusterNodes)
+		cluster.GET("/:id/namespaces", s.listClusterNamespaces)
+		cluster.GET("/:id/workloads", s.listClusterWorkloads)
+		cluster.GET("/:id/services", s.listClusterServices)
+		cluster.GET("/:id/events", s.listClusterEvents)
+		cluster.GET("/:id/resources/:group/:version/:resource", s.listClusterResources)
+		cluster.GET("/:id/resources/:group/:version/:resource/:name", s.getClusterResource)
+		cluster.GET("/:id/namespaces/:ns/pods/:pod/logs", s.streamPodLogs)
+		cluster.GET("/:id/namespaces/:ns/pods/:pod/exec", s.execPod)
 	}
 
 	// 部署API
@@ -94,11 +145,29 @@ func (s *Server) initRoutes() {
 	}
 
 	// 应用交付API
-	delivery := api.Group("/delivery")
+	delivery := api.Group("/delivery", idempotencyKeyMiddleware())
 	{
 		delivery.POST("/yaml", s.deployYaml)
 		delivery.POST("/helm", s.deployHelm)
 		delivery.POST("/kustomize", s.deployKustomize)
+		delivery.POST("/preview", s.previewDelivery)
+		delivery.GET("/tasks", s.listDeliveryTasks)
+		delivery.GET("/tasks/:id", s.getDeliveryTask)
+		delivery.POST("/tasks/:id/cancel", s.cancelDeliveryTask)
+		delivery.GET("/tasks/:id/logs", s.getDeliveryTaskLogs)
+		delivery.GET("/tasks/:id/logs/ws", s.watchDeliveryTaskLogs)
+		delivery.GET("/tasks/:id/events", s.getDeliveryTaskEvents)
+		delivery.GET("/inventory", s.getDeliveryInventory)
+	}
+
+	// 应用API
+	applications := api.Group("/applications", idempotencyKeyMiddleware())
+	{
+		applications.GET("", s.listApplications)
+		applications.GET("/:id", s.getApplication)
+		applications.GET("/:id/revisions", s.listApplicationRevisions)
+		applications.GET("/:id/revisions/:revision", s.getApplicationRevision)
+		applications.POST("/:id/rollback", s.rollbackApplication)
 	}
 
 	// 插件API
@@ -114,6 +183,17 @@ func (s *Server) initRoutes() {
 func (s *Server) Start() error {
 	addr := fmt.Sprintf("%s:%d", s.config.Server.Host, s.config.Server.Port)
 
+	// 启动集群健康检查
+	probeInterval := time.Duration(s.config.Cluster.ProbeInterval) * time.Second
+	if err := s.clusterManager.StartProber(context.Background(), probeInterval, s.config.Cluster.FailureThreshold); err != nil {
+		return fmt.Errorf("failed to start cluster prober: %w", err)
+	}
+
+	// 启动交付任务执行器
+	if err := s.deliveryManager.Start(context.Background()); err != nil {
+		return fmt.Errorf("failed to start delivery manager: %w", err)
+	}
+
 	s.httpServer = &http.Server{
 		Addr:    addr,
 		Handler: s.router,
@@ -134,6 +214,12 @@ func (s *Server) Stop() error {
 		return err
 	}
 
+	// 停止交付任务执行器
+	s.deliveryManager.Stop()
+
+	// 停止集群健康检查
+	s.clusterManager.StopProber()
+
 	// 关闭存储连接
 	return s.storageFactory.Close()
 }
@@ -194,76 +280,6 @@ func (s *Server) handleDashboardData(c *gin.Context) {
 	})
 }
 
-// 集群管理处理函数
-func (s *Server) listClusters(c *gin.Context) {
-	// TODO: 实现集群列表获取
-	clusters := []map[string]interface{}{
-		{
-			"id":        "cluster-1",
-			"status":    "Running",
-			"nodeCount": 3,
-			"createdAt": time.Now().Add(-24 * time.Hour),
-		},
-		{
-			"id":        "cluster-2",
-			"status":    "Creating",
-			"nodeCount": 1,
-			"createdAt": time.Now().Add(-1 * time.Hour),
-		},
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"clusters": clusters,
-	})
-}
-
-func (s *Server) createCluster(c *gin.Context) {
-	var data struct {
-		Name       string `json:"name"`
-		NodeCount  int    `json:"nodeCount"`
-		DeployType string `json:"deployType"`
-	}
-
-	if err := c.BindJSON(&data); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "无效的请求数据",
-		})
-		return
-	}
-
-	// TODO: 实现集群创建
-	c.JSON(http.StatusCreated, gin.H{
-		"message": fmt.Sprintf("集群 %s 创建请求已提交", data.Name),
-	})
-}
-
-func (s *Server) getCluster(c *gin.Context) {
-	id := c.Param("id")
-	// TODO: 实现获取集群详情
-	c.JSON(http.StatusOK, gin.H{
-		"id":        id,
-		"status":    "Running",
-		"nodeCount": 3,
-		"createdAt": time.Now().Add(-24 * time.Hour),
-	})
-}
-
-func (s *Server) updateCluster(c *gin.Context) {
-	id := c.Param("id")
-	// TODO: 实现更新集群
-	c.JSON(http.StatusOK, gin.H{
-		"message": fmt.Sprintf("集群 %s 更新成功", id),
-	})
-}
-
-func (s *Server) deleteCluster(c *gin.Context) {
-	id := c.Param("id")
-	// TODO: 实现删除集群
-	c.JSON(http.StatusOK, gin.H{
-		"message": fmt.Sprintf("集群 %s 删除请求已提交", id),
-	})
-}
-
 // 部署相关处理函数
 func (s *Server) deploySingleNode(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -289,25 +305,6 @@ func (s *Server) createOfflinePackage(c *gin.Context) {
 	})
 }
 
-// 应用交付相关处理函数
-func (s *Server) deployYaml(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"message": "YAML部署请求已提交",
-	})
-}
-
-func (s *Server) deployHelm(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Helm部署请求已提交",
-	})
-}
-
-func (s *Server) deployKustomize(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Kustomize部署请求已提交",
-	})
-}
-
 // 插件相关处理函数
 func (s *Server) listPlugins(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// execSubprotocol Pod终端的WebSocket子协议，通过子协议传递令牌的客户端需要同时请求该子协议
+	execSubprotocol = "kde.exec.v1"
+	// bearerSubprotocolPrefix 携带base64url编码的管理员令牌的子协议前缀
+	// 浏览器的WebSocket无法设置Authorization头，令牌只能通过Sec-WebSocket-Protocol传递
+	bearerSubprotocolPrefix = "base64url.bearer.kde."
+)
+
+// newWSUpgrader 创建WebSocket升级器，只接受同源或allowedOrigins中的来源
+// 浏览器跨站发起的WebSocket连接不受同源策略限制，必须校验Origin
+func newWSUpgrader(allowedOrigins []string, subprotocols ...string) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		Subprotocols:    subprotocols,
+		CheckOrigin: func(r *http.Request) bool {
+			return checkOrigin(r, allowedOrigins)
+		},
+	}
+}
+
+// subprotocolToken 从Sec-WebSocket-Protocol请求头中读取管理员令牌，不存在时返回空字符串
+func subprotocolToken(r *http.Request) string {
+	for _, protocol := range websocket.Subprotocols(r) {
+		encoded, ok := strings.CutPrefix(protocol, bearerSubprotocolPrefix)
+		if !ok {
+			continue
+		}
+		if token, err := base64.RawURLEncoding.DecodeString(encoded); err == nil {
+			return string(token)
+		}
+	}
+	return ""
+}
+
+// checkOrigin 判断请求的Origin是否与Host相同或在允许列表中
+// 没有Origin头的请求来自非浏览器客户端，允许连接
+func checkOrigin(r *http.Request, allowedOrigins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, allowed := range allowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
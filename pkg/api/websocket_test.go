@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	allowed := []string{"https://console.example.com/", "http://localhost:3000"}
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{name: "no origin", want: true},
+		{name: "same host", origin: "https://kde.example.com", want: true},
+		{name: "same host different case", origin: "https://KDE.example.com", want: true},
+		{name: "allowed origin", origin: "https://console.example.com", want: true},
+		{name: "allowed origin with port", origin: "http://localhost:3000", want: true},
+		{name: "other site", origin: "https://evil.example.net"},
+		{name: "allowed host with other scheme", origin: "http://console.example.com"},
+		{name: "same host with other port", origin: "https://kde.example.com:8443"},
+		{name: "invalid origin", origin: "://"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/v1/clusters/c1/pods/default/web/exec", nil)
+			r.Host = "kde.example.com"
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := checkOrigin(r, allowed); got != tt.want {
+				t.Errorf("checkOrigin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubprotocolToken(t *testing.T) {
+	encoded := base64.RawURLEncoding.EncodeToString([]byte("admin-token/+="))
+	tests := []struct {
+		name     string
+		protocol string
+		want     string
+	}{
+		{name: "no subprotocol"},
+		{name: "exec only", protocol: execSubprotocol},
+		{name: "token", protocol: execSubprotocol + ", " + bearerSubprotocolPrefix + encoded, want: "admin-token/+="},
+		{name: "token first", protocol: bearerSubprotocolPrefix + encoded + "," + execSubprotocol, want: "admin-token/+="},
+		{name: "invalid encoding", protocol: execSubprotocol + ", " + bearerSubprotocolPrefix + "not*base64"},
+		{name: "other prefix", protocol: "base64url.bearer.authorization.k8s.io." + encoded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/v1/clusters/c1/pods/default/web/exec", nil)
+			if tt.protocol != "" {
+				r.Header.Set("Sec-WebSocket-Protocol", tt.protocol)
+			}
+			if got := subprotocolToken(r); got != tt.want {
+				t.Errorf("subprotocolToken() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/huyouba1/kde/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// cacheSyncTimeout 等待集群缓存首次同步的超时时间
+	cacheSyncTimeout = 30 * time.Second
+	// defaultEventLimit 事件列表默认返回的条数
+	defaultEventLimit = 200
+)
+
+// namespaceSummary 命名空间摘要
+type namespaceSummary struct {
+	Name      string            `json:"name"`
+	Status    string            `json:"status"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// workloadSummary 工作负载摘要
+type workloadSummary struct {
+	Kind          string    `json:"kind"`
+	Namespace     string    `json:"namespace"`
+	Name          string    `json:"name"`
+	Replicas      int32     `json:"replicas"`
+	ReadyReplicas int32     `json:"ready_replicas"`
+	Images        []string  `json:"images"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// serviceSummary 服务摘要
+type serviceSummary struct {
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Type      string            `json:"type"`
+	ClusterIP string            `json:"cluster_ip"`
+	Ports     []string          `json:"ports"`
+	Selector  map[string]string `json:"selector,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// eventSummary 事件摘要
+type eventSummary struct {
+	Namespace      string    `json:"namespace"`
+	Type           string    `json:"type"`
+	Reason         string    `json:"reason"`
+	Message        string    `json:"message"`
+	InvolvedObject string    `json:"involved_object"`
+	Count          int32     `json:"count"`
+	LastSeen       time.Time `json:"last_seen"`
+}
+
+// listClusterNamespaces 从缓存获取集群的命名空间
+func (s *Server) listClusterNamespaces(c *gin.Context) {
+	informerCache, ok := s.clusterCache(c)
+	if !ok {
+		return
+	}
+
+	namespaces, err := informerCache.Namespaces().List(labels.Everything())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	items := make([]namespaceSummary, 0, len(namespaces))
+	for _, ns := range namespaces {
+		items = append(items, namespaceSummary{
+			Name:      ns.Name,
+			Status:    string(ns.Status.Phase),
+			Labels:    ns.Labels,
+			CreatedAt: ns.CreationTimestamp.Time,
+		})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+
+	respondCached(c, informerCache, items)
+}
+
+// listClusterWorkloads 从缓存获取集群的Deployment、StatefulSet和DaemonSet
+func (s *Server) listClusterWorkloads(c *gin.Context) {
+	informerCache, ok := s.clusterCache(c)
+	if !ok {
+		return
+	}
+	namespace := c.Query("namespace")
+
+	var (
+		deployments  []*appsv1.Deployment
+		statefulSets []*appsv1.StatefulSet
+		daemonSets   []*appsv1.DaemonSet
+		err          error
+	)
+	if namespace != "" {
+		deployments, err = informerCache.Deployments().Deployments(namespace).List(labels.Everything())
+		if err == nil {
+			statefulSets, err = informerCache.StatefulSets().StatefulSets(namespace).List(labels.Everything())
+		}
+		if err == nil {
+			daemonSets, err = informerCache.DaemonSets().DaemonSets(namespace).List(labels.Everything())
+		}
+	} else {
+		deployments, err = informerCache.Deployments().List(labels.Everything())
+		if err == nil {
+			statefulSets, err = informerCache.StatefulSets().List(labels.Everything())
+		}
+		if err == nil {
+			daemonSets, err = informerCache.DaemonSets().List(labels.Everything())
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	items := make([]workloadSummary, 0, len(deployments)+len(statefulSets)+len(daemonSets))
+	for _, d := range deployments {
+		items = append(items, workloadSummary{
+			Kind:          "Deployment",
+			Namespace:     d.Namespace,
+			Name:          d.Name,
+			Replicas:      d.Status.Replicas,
+			ReadyReplicas: d.Status.ReadyReplicas,
+			Images:        containerImages(d.Spec.Template.Spec),
+			CreatedAt:     d.CreationTimestamp.Time,
+		})
+	}
+	for _, sts := range statefulSets {
+		items = append(items, workloadSummary{
+			Kind:          "StatefulSet",
+			Namespace:     sts.Namespace,
+			Name:          sts.Name,
+			Replicas:      sts.Status.Replicas,
+			ReadyReplicas: sts.Status.ReadyReplicas,
+			Images:        containerImages(sts.Spec.Template.Spec),
+			CreatedAt:     sts.CreationTimestamp.Time,
+		})
+	}
+	for _, ds := range daemonSets {
+		items = append(items, workloadSummary{
+			Kind:          "DaemonSet",
+			Namespace:     ds.Namespace,
+			Name:          ds.Name,
+			Replicas:      ds.Status.DesiredNumberScheduled,
+			ReadyReplicas: ds.Status.NumberReady,
+			Images:        containerImages(ds.Spec.Template.Spec),
+			CreatedAt:     ds.CreationTimestamp.Time,
+		})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Namespace != items[j].Namespace {
+			return items[i].Namespace < items[j].Namespace
+		}
+		if items[i].Name != items[j].Name {
+			return items[i].Name < items[j].Name
+		}
+		return items[i].Kind < items[j].Kind
+	})
+
+	respondCached(c, informerCache, items)
+}
+
+// listClusterServices 从缓存获取集群的服务
+func (s *Server) listClusterServices(c *gin.Context) {
+	informerCache, ok := s.clusterCache(c)
+	if !ok {
+		return
+	}
+
+	var (
+		services []*corev1.Service
+		err      error
+	)
+	if namespace := c.Query("namespace"); namespace != "" {
+		services, err = informerCache.Services().Services(namespace).List(labels.Everything())
+	} else {
+		services, err = informerCache.Services().List(labels.Everything())
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	items := make([]serviceSummary, 0, len(services))
+	for _, svc := range services {
+		ports := make([]string, 0, len(svc.Spec.Ports))
+		for _, port := range svc.Spec.Ports {
+			ports = append(ports, fmt.Sprintf("%d/%s", port.Port, port.Protocol))
+		}
+		items = append(items, serviceSummary{
+			Namespace: svc.Namespace,
+			Name:      svc.Name,
+			Type:      string(svc.Spec.Type),
+			ClusterIP: svc.Spec.ClusterIP,
+			Ports:     ports,
+			Selector:  svc.Spec.Selector,
+			CreatedAt: svc.CreationTimestamp.Time,
+		})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Namespace != items[j].Namespace {
+			return items[i].Namespace < items[j].Namespace
+		}
+		return items[i].Name < items[j].Name
+	})
+
+	respondCached(c, informerCache, items)
+}
+
+// listClusterEvents 从缓存获取集群的事件，按最近发生时间倒序
+func (s *Server) listClusterEvents(c *gin.Context) {
+	informerCache, ok := s.clusterCache(c)
+	if !ok {
+		return
+	}
+
+	limit, err := parseIntQuery(c, "limit", defaultEventLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var events []*corev1.Event
+	if namespace := c.Query("namespace"); namespace != "" {
+		events, err = informerCache.Events().Events(namespace).List(labels.Everything())
+	} else {
+		events, err = informerCache.Events().List(labels.Everything())
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	items := make([]eventSummary, 0, len(events))
+	for _, event := range events {
+		items = append(items, eventSummary{
+			Namespace:      event.Namespace,
+			Type:           event.Type,
+			Reason:         event.Reason,
+			Message:        event.Message,
+			InvolvedObject: event.InvolvedObject.Kind + "/" + event.InvolvedObject.Name,
+			Count:          event.Count,
+			LastSeen:       k8s.EventLastSeen(event),
+		})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].LastSeen.After(items[j].LastSeen) })
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+
+	respondCached(c, informerCache, items)
+}
+
+// clusterCache 获取请求中集群的缓存，失败时已写入错误响应
+func (s *Server) clusterCache(c *gin.Context) (*k8s.Cache, bool) {
+	id := c.Param("id")
+	if _, err := s.clusterManager.GetCluster(c.Request.Context(), id); err != nil {
+		respondClusterError(c, err)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), cacheSyncTimeout)
+	defer cancel()
+
+	informerCache, err := s.clusterManager.GetCache(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return informerCache, true
+}
+
+// respondCached 返回缓存中的数据和缓存状态
+func respondCached(c *gin.Context, informerCache *k8s.Cache, items interface{}) {
+	c.JSON(http.StatusOK, gin.H{
+		"items": items,
+		"cache": informerCache.Status(),
+	})
+}
+
+// containerImages 返回Pod模板中所有容器的镜像
+func containerImages(spec corev1.PodSpec) []string {
+	images := make([]string, 0, len(spec.Containers))
+	for _, container := range spec.Containers {
+		images = append(images, container.Image)
+	}
+	return images
+}
@@ -0,0 +1,255 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huyouba1/kde/pkg/storage/models"
+)
+
+const (
+	// probeHistorySize 每个集群保留的健康检查记录数
+	probeHistorySize = 20
+	// probeTimeout 单次健康检查的超时时间
+	probeTimeout = 15 * time.Second
+)
+
+// ProbeRecord 一次健康检查的结果
+type ProbeRecord struct {
+	Time    time.Time            `json:"time"`
+	Status  models.ClusterStatus `json:"status"`
+	Latency time.Duration        `json:"latency"`
+	Error   string               `json:"error,omitempty"`
+}
+
+// ClusterHealth 集群的健康状态和最近的检查记录
+type ClusterHealth struct {
+	ClusterID           string               `json:"cluster_id"`
+	Status              models.ClusterStatus `json:"status"`
+	ConsecutiveFailures int                  `json:"consecutive_failures"`
+	LastProbe           time.Time            `json:"last_probe"`
+	History             []ProbeRecord        `json:"history"`
+}
+
+// healthProber 定期检查所有集群的健康状态
+type healthProber struct {
+	interval         time.Duration
+	failureThreshold int
+
+	mu     sync.RWMutex
+	health map[string]*ClusterHealth
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// StartProber 启动集群健康检查，每隔interval检查一次所有集群
+// 连续失败failureThreshold次后丢弃缓存的客户端，下次检查时重新读取凭据
+func (m *ClusterManager) StartProber(ctx context.Context, interval time.Duration, failureThreshold int) error {
+	if interval <= 0 {
+		return nil
+	}
+	if failureThreshold <= 0 {
+		failureThreshold = 1
+	}
+
+	m.proberMu.Lock()
+	defer m.proberMu.Unlock()
+	if m.prober != nil {
+		return fmt.Errorf("集群健康检查已启动")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	p := &healthProber{
+		interval:         interval,
+		failureThreshold: failureThreshold,
+		health:           make(map[string]*ClusterHealth),
+		cancel:           cancel,
+	}
+	m.prober = p
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		m.runProber(ctx, p)
+	}()
+
+	return nil
+}
+
+// StopProber 停止集群健康检查并等待正在进行的检查结束
+func (m *ClusterManager) StopProber() {
+	m.proberMu.Lock()
+	p := m.prober
+	m.proberMu.Unlock()
+	if p == nil {
+		return
+	}
+
+	p.cancel()
+	p.wg.Wait()
+}
+
+// GetClusterHealth 获取集群的健康状态，尚未检查过时返回false
+func (m *ClusterManager) GetClusterHealth(clusterID string) (*ClusterHealth, bool) {
+	m.proberMu.Lock()
+	p := m.prober
+	m.proberMu.Unlock()
+	if p == nil {
+		return nil, false
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	health, ok := p.health[clusterID]
+	if !ok {
+		return nil, false
+	}
+	copied := *health
+	copied.History = append([]ProbeRecord(nil), health.History...)
+	return &copied, true
+}
+
+// runProber 定期检查所有集群直到上下文取消
+func (m *ClusterManager) runProber(ctx context.Context, p *healthProber) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		m.probeAll(ctx, p)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// probeAll 并发检查所有集群
+func (m *ClusterManager) probeAll(ctx context.Context, p *healthProber) {
+	clusters, err := m.ListClusters(ctx)
+	if err != nil {
+		fmt.Printf("集群健康检查: %v\n", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	known := make(map[string]struct{}, len(clusters))
+	for _, cluster := range clusters {
+		known[cluster.ID] = struct{}{}
+
+		// 创建和删除中的集群不参与检查
+		if cluster.Status == models.StatusCreating || cluster.Status == models.StatusDeleting {
+			continue
+		}
+
+		wg.Add(1)
+		go func(cluster *models.ClusterModel) {
+			defer wg.Done()
+			m.probeCluster(ctx, p, cluster)
+		}(cluster)
+	}
+	wg.Wait()
+
+	// 清理已删除集群的检查记录
+	p.mu.Lock()
+	for id := range p.health {
+		if _, ok := known[id]; !ok {
+			delete(p.health, id)
+		}
+	}
+	p.mu.Unlock()
+}
+
+// probeCluster 检查单个集群并更新其状态
+func (m *ClusterManager) probeCluster(ctx context.Context, p *healthProber, cluster *models.ClusterModel) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	record := ProbeRecord{Time: start, Status: models.StatusActive}
+	version, nodeCount := cluster.Version, cluster.NodeCount
+
+	client, err := m.GetClient(cluster.ID)
+	if err == nil {
+		health, checkErr := client.CheckHealth(ctx)
+		switch {
+		case checkErr != nil:
+			err = checkErr
+		case !health.Healthy():
+			// 能连接但不健康
+			record.Status = models.StatusError
+			record.Error = strings.Join(health.Problems, "; ")
+			fallthrough
+		default:
+			version, nodeCount = health.Version, health.NodeCount
+			info := &models.ClusterInfo{
+				Version:        health.Version,
+				NodeCount:      health.NodeCount,
+				NamespaceCount: health.NamespaceCount,
+			}
+			if err := m.db.UpdateClusterInfo(cluster.ID, info); err != nil {
+				fmt.Printf("集群 %s: 保存集群信息失败: %v\n", cluster.ID, err)
+			}
+			if _, err := m.syncNodes(ctx, cluster.ID, client); err != nil {
+				fmt.Printf("集群 %s: 同步节点清单失败: %v\n", cluster.ID, err)
+			}
+		}
+	}
+	if err != nil {
+		// 无法连接
+		record.Status = models.StatusInactive
+		record.Error = err.Error()
+	}
+	record.Latency = time.Since(start)
+
+	// 检查器停止导致的失败不计入检查结果，单次检查超时仍计为失败
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return
+	}
+
+	failures := p.record(cluster.ID, record)
+	if failures >= p.failureThreshold {
+		// 丢弃缓存的客户端，下次检查时使用数据库中最新的凭据重新连接
+		m.RemoveClient(cluster.ID)
+	}
+
+	if record.Status != cluster.Status || version != cluster.Version || nodeCount != cluster.NodeCount {
+		if err := m.db.UpdateClusterStatus(cluster.ID, record.Status, version, nodeCount); err != nil {
+			fmt.Printf("集群 %s: 更新集群状态失败: %v\n", cluster.ID, err)
+		}
+	}
+}
+
+// record 保存检查记录，返回连续失败次数
+func (p *healthProber) record(clusterID string, record ProbeRecord) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	health, ok := p.health[clusterID]
+	if !ok {
+		health = &ClusterHealth{ClusterID: clusterID}
+		p.health[clusterID] = health
+	}
+
+	health.Status = record.Status
+	health.LastProbe = record.Time
+	if record.Status == models.StatusActive {
+		health.ConsecutiveFailures = 0
+	} else {
+		health.ConsecutiveFailures++
+	}
+
+	health.History = append(health.History, record)
+	if len(health.History) > probeHistorySize {
+		health.History = health.History[len(health.History)-probeHistorySize:]
+	}
+
+	return health.ConsecutiveFailures
+}
@@ -0,0 +1,178 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/huyouba1/kde/pkg/storage/models"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// KubeconfigContext kubeconfig中的一个上下文
+type KubeconfigContext struct {
+	Name      string `json:"name"`
+	Cluster   string `json:"cluster"`
+	User      string `json:"user"`
+	Namespace string `json:"namespace,omitempty"`
+	Server    string `json:"server"`
+	Current   bool   `json:"current"`
+	// Supported 为false时该上下文不能导入，原因见Reason
+	Supported bool   `json:"supported"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// ImportResult 单个上下文的导入结果
+type ImportResult struct {
+	Context string               `json:"context"`
+	Cluster *models.ClusterModel `json:"cluster,omitempty"`
+	Error   string               `json:"error,omitempty"`
+}
+
+// ParseKubeconfig 解析kubeconfig，按名称顺序列出其中的上下文
+func ParseKubeconfig(data []byte) ([]KubeconfigContext, error) {
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("解析kubeconfig失败: %v", err)
+	}
+
+	names := make([]string, 0, len(config.Contexts))
+	for name := range config.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	contexts := make([]KubeconfigContext, 0, len(names))
+	for _, name := range names {
+		kctx := config.Contexts[name]
+		item := KubeconfigContext{
+			Name:      name,
+			Cluster:   kctx.Cluster,
+			User:      kctx.AuthInfo,
+			Namespace: kctx.Namespace,
+			Current:   name == config.CurrentContext,
+			Supported: true,
+		}
+		if cluster, ok := config.Clusters[kctx.Cluster]; ok {
+			item.Server = cluster.Server
+		}
+		if reason := unsupportedReason(config, kctx); reason != "" {
+			item.Supported = false
+			item.Reason = reason
+		}
+		contexts = append(contexts, item)
+	}
+
+	return contexts, nil
+}
+
+// MinimizeKubeconfig 生成只包含指定上下文及其集群、用户和证书的kubeconfig
+func MinimizeKubeconfig(data []byte, contextName string) (string, error) {
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		return "", fmt.Errorf("解析kubeconfig失败: %v", err)
+	}
+
+	kctx, ok := config.Contexts[contextName]
+	if !ok {
+		return "", fmt.Errorf("上下文 %s 不存在", contextName)
+	}
+	if reason := unsupportedReason(config, kctx); reason != "" {
+		return "", fmt.Errorf("上下文 %s 不支持导入: %s", contextName, reason)
+	}
+
+	minimized := clientcmdapi.NewConfig()
+	minimized.Clusters[kctx.Cluster] = config.Clusters[kctx.Cluster]
+	minimized.AuthInfos[kctx.AuthInfo] = config.AuthInfos[kctx.AuthInfo]
+	minimized.Contexts[contextName] = kctx
+	minimized.CurrentContext = contextName
+
+	out, err := clientcmd.Write(*minimized)
+	if err != nil {
+		return "", fmt.Errorf("生成kubeconfig失败: %v", err)
+	}
+	return string(out), nil
+}
+
+// checkKubeconfig 检查kubeconfig实际使用的上下文能否在服务端使用，必须在创建客户端之前调用
+// exec插件、auth-provider和本地文件引用会在服务端执行命令或读取文件，一律拒绝
+func checkKubeconfig(data []byte, contextName string) error {
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		return err
+	}
+
+	if contextName == "" {
+		contextName = config.CurrentContext
+	}
+	kctx, ok := config.Contexts[contextName]
+	if !ok {
+		return fmt.Errorf("上下文 %q 不存在", contextName)
+	}
+	if reason := unsupportedReason(config, kctx); reason != "" {
+		return fmt.Errorf("上下文 %s 不支持: %s", contextName, reason)
+	}
+	return nil
+}
+
+// unsupportedReason 检查上下文能否在服务端使用，返回不支持的原因
+func unsupportedReason(config *clientcmdapi.Config, kctx *clientcmdapi.Context) string {
+	cluster, ok := config.Clusters[kctx.Cluster]
+	if !ok {
+		return fmt.Sprintf("集群 %s 不存在", kctx.Cluster)
+	}
+	user, ok := config.AuthInfos[kctx.AuthInfo]
+	if !ok {
+		return fmt.Sprintf("用户 %s 不存在", kctx.AuthInfo)
+	}
+
+	// exec插件和auth-provider依赖本地命令或登录状态，服务端无法执行
+	if user.Exec != nil {
+		return "不支持exec插件认证"
+	}
+	if user.AuthProvider != nil {
+		return "不支持auth-provider认证"
+	}
+
+	// 引用的本地文件在服务端不存在，证书和令牌必须内嵌在kubeconfig中
+	if cluster.CertificateAuthority != "" || user.ClientCertificate != "" ||
+		user.ClientKey != "" || user.TokenFile != "" {
+		return "证书或令牌引用了本地文件，请使用内嵌数据"
+	}
+
+	return ""
+}
+
+// ImportContexts 将kubeconfig中选中的上下文分别注册为集群
+// 每个上下文独立注册，单个上下文失败不影响其他上下文
+func (m *ClusterManager) ImportContexts(ctx context.Context, data []byte, contexts []string, description string) ([]*ImportResult, error) {
+	if _, err := clientcmd.Load(data); err != nil {
+		return nil, fmt.Errorf("%w: 解析kubeconfig失败: %v", ErrConnectFailed, err)
+	}
+
+	results := make([]*ImportResult, 0, len(contexts))
+	for _, name := range contexts {
+		result := &ImportResult{Context: name}
+		results = append(results, result)
+
+		kubeconfig, err := MinimizeKubeconfig(data, name)
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+
+		cluster := &models.ClusterModel{
+			Name:        name,
+			Description: description,
+			KubeConfig:  kubeconfig,
+		}
+		if err := m.RegisterCluster(ctx, cluster); err != nil {
+			result.Error = err.Error()
+			continue
+		}
+		result.Cluster = cluster
+	}
+
+	return results, nil
+}
@@ -0,0 +1,173 @@
+package cluster
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// testKubeconfig 包含可导入的prod、staging上下文和各类不支持的上下文
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: prod
+clusters:
+- name: prod
+  cluster:
+    server: https://prod.example.com:6443
+    certificate-authority-data: Y2E=
+- name: staging
+  cluster:
+    server: https://staging.example.com:6443
+- name: local-ca
+  cluster:
+    server: https://local.example.com:6443
+    certificate-authority: /etc/kubernetes/ca.crt
+users:
+- name: prod-admin
+  user:
+    token: prod-token
+- name: staging-admin
+  user:
+    client-certificate-data: Y2VydA==
+    client-key-data: a2V5
+- name: exec-user
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1
+      command: /usr/bin/id
+- name: provider-user
+  user:
+    auth-provider:
+      name: oidc
+- name: token-file-user
+  user:
+    tokenFile: /var/run/secrets/token
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: prod-admin
+    namespace: apps
+- name: staging
+  context:
+    cluster: staging
+    user: staging-admin
+- name: exec
+  context:
+    cluster: prod
+    user: exec-user
+- name: auth-provider
+  context:
+    cluster: prod
+    user: provider-user
+- name: token-file
+  context:
+    cluster: prod
+    user: token-file-user
+- name: local-ca
+  context:
+    cluster: local-ca
+    user: prod-admin
+- name: missing-cluster
+  context:
+    cluster: unknown
+    user: prod-admin
+- name: missing-user
+  context:
+    cluster: prod
+    user: unknown
+`
+
+func TestCheckKubeconfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		context string
+		wantErr string
+	}{
+		{name: "current context", data: testKubeconfig},
+		{name: "selected context", data: testKubeconfig, context: "staging"},
+		{name: "exec plugin", data: testKubeconfig, context: "exec", wantErr: "exec"},
+		{name: "auth provider", data: testKubeconfig, context: "auth-provider", wantErr: "auth-provider"},
+		{name: "token file", data: testKubeconfig, context: "token-file", wantErr: "本地文件"},
+		{name: "certificate authority file", data: testKubeconfig, context: "local-ca", wantErr: "本地文件"},
+		{name: "missing cluster", data: testKubeconfig, context: "missing-cluster", wantErr: "集群 unknown 不存在"},
+		{name: "missing user", data: testKubeconfig, context: "missing-user", wantErr: "用户 unknown 不存在"},
+		{name: "unknown context", data: testKubeconfig, context: "dev", wantErr: "不存在"},
+		{
+			name:    "current context uses exec plugin",
+			data:    strings.Replace(testKubeconfig, "current-context: prod", "current-context: exec", 1),
+			wantErr: "exec",
+		},
+		{name: "invalid kubeconfig", data: "clusters: [", wantErr: "yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkKubeconfig([]byte(tt.data), tt.context)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkKubeconfig() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkKubeconfig() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMinimizeKubeconfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		context     string
+		wantCluster string
+		wantUser    string
+		wantErr     bool
+	}{
+		{name: "token user", context: "prod", wantCluster: "prod", wantUser: "prod-admin"},
+		{name: "certificate user", context: "staging", wantCluster: "staging", wantUser: "staging-admin"},
+		{name: "unsupported context", context: "exec", wantErr: true},
+		{name: "unknown context", context: "dev", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := MinimizeKubeconfig([]byte(testKubeconfig), tt.context)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MinimizeKubeconfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			config, err := clientcmd.Load([]byte(out))
+			if err != nil {
+				t.Fatalf("minimized kubeconfig is invalid: %v", err)
+			}
+			if config.CurrentContext != tt.context || len(config.Contexts) != 1 {
+				t.Errorf("contexts = %d, current = %q, want only %q", len(config.Contexts), config.CurrentContext, tt.context)
+			}
+			if _, ok := config.Clusters[tt.wantCluster]; !ok || len(config.Clusters) != 1 {
+				t.Errorf("clusters = %v, want only %q", keys(config.Clusters), tt.wantCluster)
+			}
+			if _, ok := config.AuthInfos[tt.wantUser]; !ok || len(config.AuthInfos) != 1 {
+				t.Errorf("users = %v, want only %q", keys(config.AuthInfos), tt.wantUser)
+			}
+			if err := checkKubeconfig([]byte(out), ""); err != nil {
+				t.Errorf("checkKubeconfig() on minimized kubeconfig error = %v", err)
+			}
+		})
+	}
+}
+
+// keys 返回map的键，用于错误信息
+func keys[V any](m map[string]V) []string {
+	result := make([]string, 0, len(m))
+	for key := range m {
+		result = append(result, key)
+	}
+	return result
+}
@@ -2,13 +2,33 @@ package cluster
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/huyouba1/kde/configs"
 	"github.com/huyouba1/kde/pkg/k8s"
 	"github.com/huyouba1/kde/pkg/storage"
 	"github.com/huyouba1/kde/pkg/storage/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrClusterNotFound 集群不存在
+	ErrClusterNotFound = errors.New("集群不存在")
+	// ErrConnectFailed kubeconfig无效或集群无法连接
+	ErrConnectFailed = errors.New("集群连接失败")
+)
+
+const (
+	// defaultClientQPS 集群客户端的默认请求速率
+	defaultClientQPS = 50
+	// defaultClientBurst 集群客户端的默认突发上限
+	defaultClientBurst = 100
+	// defaultDialTimeout 连接API Server的超时时间
+	defaultDialTimeout = 10 * time.Second
 )
 
 // ClusterStatus 集群状态
@@ -43,14 +63,19 @@ type Cluster struct {
 
 // Node 表示一个Kubernetes节点
 type Node struct {
-	Name       string
-	ClusterID  string
-	Status     string
-	Role       string
-	IP         string
-	Version    string
-	Labels     map[string]string
-	Conditions []models.NodeCondition
+	Name        string                 `json:"name"`
+	ClusterID   string                 `json:"cluster_id"`
+	Status      string                 `json:"status"`
+	Role        string                 `json:"role"`
+	IP          string                 `json:"ip"`
+	Version     string                 `json:"version"`
+	Labels      map[string]string      `json:"labels"`
+	Taints      []models.NodeTaint     `json:"taints"`
+	Capacity    map[string]string      `json:"capacity"`
+	Allocatable map[string]string      `json:"allocatable"`
+	Conditions  []models.NodeCondition `json:"conditions"`
+	// UpdatedAt 最近一次同步的时间
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // ClusterManager 管理集群
@@ -58,13 +83,24 @@ type ClusterManager struct {
 	db        *storage.DB
 	clients   map[string]*k8s.Client
 	clientsMu sync.RWMutex
+	// clientOptions 创建集群客户端时使用的配置
+	clientOptions k8s.Options
+	// prober 集群健康检查，StartProber启动后才存在
+	prober   *healthProber
+	proberMu sync.Mutex
 }
 
 // NewClusterManager 创建一个新的集群管理器
-func NewClusterManager(db *storage.DB) *ClusterManager {
+func NewClusterManager(db *storage.DB, cfg *configs.ClusterConfig) *ClusterManager {
 	return &ClusterManager{
 		db:      db,
 		clients: make(map[string]*k8s.Client),
+		clientOptions: k8s.Options{
+			QPS:          defaultClientQPS,
+			Burst:        defaultClientBurst,
+			DialTimeout:  defaultDialTimeout,
+			ResyncPeriod: time.Duration(cfg.ResyncPeriod) * time.Second,
+		},
 	}
 }
 
@@ -84,21 +120,31 @@ func (m *ClusterManager) GetClient(clusterID string) (*k8s.Client, error) {
 		return nil, fmt.Errorf("failed to get cluster: %w", err)
 	}
 
+	// 未配置 kubeconfig 时不能回退到默认配置，否则会连接到错误的集群
+	if cluster.KubeConfig == "" {
+		return nil, fmt.Errorf("cluster %s has no kubeconfig", clusterID)
+	}
+
 	// 创建新的 Kubernetes 客户端
-	client, err = k8s.NewClient(cluster.KubeConfig)
+	client, err = m.newClient(cluster.KubeConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
 	}
 
 	// 测试连接
 	if err := client.TestConnection(context.Background()); err != nil {
+		client.Close()
 		return nil, fmt.Errorf("failed to connect to cluster: %w", err)
 	}
 
-	// 缓存客户端
+	// 缓存客户端，并发创建时使用先缓存的客户端
 	m.clientsMu.Lock()
+	defer m.clientsMu.Unlock()
+	if existing, ok := m.clients[clusterID]; ok {
+		client.Close()
+		return existing, nil
+	}
 	m.clients[clusterID] = client
-	m.clientsMu.Unlock()
 
 	return client, nil
 }
@@ -122,17 +168,48 @@ func (m *ClusterManager) GetClusterInfo(clusterID string) (*models.ClusterInfo,
 	}, nil
 }
 
-// RemoveClient 移除指定集群的客户端
+// RemoveClient 移除指定集群的客户端，并停止其共享 informer 缓存
 func (m *ClusterManager) RemoveClient(clusterID string) {
+	m.replaceClient(clusterID, nil)
+}
+
+// replaceClient 替换缓存的客户端并关闭旧客户端，client为nil时只移除
+func (m *ClusterManager) replaceClient(clusterID string, client *k8s.Client) {
 	m.clientsMu.Lock()
-	delete(m.clients, clusterID)
+	old := m.clients[clusterID]
+	if client != nil {
+		m.clients[clusterID] = client
+	} else {
+		delete(m.clients, clusterID)
+	}
 	m.clientsMu.Unlock()
+
+	if old != nil && old != client {
+		old.Close()
+	}
+}
+
+// GetCache 获取集群的共享 informer 缓存，首次调用时启动并等待同步完成
+func (m *ClusterManager) GetCache(ctx context.Context, clusterID string) (*k8s.Cache, error) {
+	client, err := m.GetClient(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	informerCache, err := client.Cache(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("同步集群 %s 的缓存失败: %v", clusterID, err)
+	}
+	return informerCache, nil
 }
 
 // GetCluster 获取集群信息
 func (m *ClusterManager) GetCluster(ctx context.Context, id string) (*models.ClusterModel, error) {
 	cluster, err := m.db.GetCluster(id)
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrClusterNotFound
+		}
 		return nil, fmt.Errorf("查询集群失败: %v", err)
 	}
 	return cluster, nil
@@ -173,6 +250,89 @@ func (m *ClusterManager) UpdateCluster(ctx context.Context, cluster *models.Clus
 	return nil
 }
 
+// RegisterCluster 使用kubeconfig注册集群
+// 注册前测试连接，并从集群读取API Server地址、版本和节点数
+func (m *ClusterManager) RegisterCluster(ctx context.Context, cluster *models.ClusterModel) error {
+	client, err := m.connect(ctx, cluster)
+	if err != nil {
+		return err
+	}
+
+	cluster.ID = uuid.NewString()
+	if err := m.CreateCluster(ctx, cluster); err != nil {
+		client.Close()
+		return err
+	}
+
+	// 缓存客户端
+	m.replaceClient(cluster.ID, client)
+
+	// 节点清单同步失败不影响注册，健康检查时会再次同步
+	if _, err := m.syncNodes(ctx, cluster.ID, client); err != nil {
+		fmt.Printf("集群 %s: 同步节点清单失败: %v\n", cluster.ID, err)
+	}
+
+	return nil
+}
+
+// UpdateKubeConfig 更换集群的kubeconfig，测试连接通过后才会保存
+func (m *ClusterManager) UpdateKubeConfig(ctx context.Context, cluster *models.ClusterModel, kubeconfig string) error {
+	cluster.KubeConfig = kubeconfig
+	client, err := m.connect(ctx, cluster)
+	if err != nil {
+		return err
+	}
+
+	if err := m.UpdateCluster(ctx, cluster); err != nil {
+		client.Close()
+		return err
+	}
+
+	// 替换缓存的客户端
+	m.replaceClient(cluster.ID, client)
+
+	return nil
+}
+
+// connect 使用集群的kubeconfig创建客户端并测试连接，同时填充集群的基本信息
+// 连接失败时关闭已创建的客户端，成功时由调用方负责缓存或关闭
+func (m *ClusterManager) connect(ctx context.Context, cluster *models.ClusterModel) (*k8s.Client, error) {
+	if cluster.KubeConfig == "" {
+		return nil, fmt.Errorf("%w: kubeconfig不能为空", ErrConnectFailed)
+	}
+
+	client, err := m.newClient(cluster.KubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 解析kubeconfig失败: %v", ErrConnectFailed, err)
+	}
+
+	if err := client.TestConnection(ctx); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("%w: %v", ErrConnectFailed, err)
+	}
+
+	info, err := client.GetClusterInfo(ctx)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("%w: 获取集群信息失败: %v", ErrConnectFailed, err)
+	}
+
+	cluster.APIServer = client.GetConfig().Host
+	cluster.Version = info.Version
+	cluster.NodeCount = info.NodeCount
+	cluster.Status = models.StatusActive
+
+	return client, nil
+}
+
+// newClient 校验kubeconfig后使用其内容创建客户端，所有集群客户端都经由这里创建
+func (m *ClusterManager) newClient(kubeconfig string) (*k8s.Client, error) {
+	if err := checkKubeconfig([]byte(kubeconfig), m.clientOptions.Context); err != nil {
+		return nil, err
+	}
+	return k8s.NewClientFromKubeconfig([]byte(kubeconfig), &m.clientOptions)
+}
+
 // DeleteCluster 删除集群
 func (m *ClusterManager) DeleteCluster(ctx context.Context, id string) error {
 	// 删除集群记录
@@ -180,6 +340,11 @@ func (m *ClusterManager) DeleteCluster(ctx context.Context, id string) error {
 		return fmt.Errorf("删除集群失败: %v", err)
 	}
 
+	// 删除节点清单
+	if err := m.db.DeleteNodes(id); err != nil {
+		return fmt.Errorf("删除集群节点失败: %v", err)
+	}
+
 	// 移除客户端缓存
 	m.RemoveClient(id)
 
@@ -0,0 +1,211 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/huyouba1/kde/pkg/k8s"
+	"github.com/huyouba1/kde/pkg/storage/models"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// nodeRoleLabelPrefix 节点角色标签前缀
+	nodeRoleLabelPrefix = "node-role.kubernetes.io/"
+	// defaultNodeRole 没有角色标签的节点
+	defaultNodeRole = "worker"
+)
+
+// SyncNodes 从集群同步节点清单到数据库，删除集群中已不存在的节点，返回同步的节点数
+func (m *ClusterManager) SyncNodes(ctx context.Context, clusterID string) (int, error) {
+	client, err := m.GetClient(clusterID)
+	if err != nil {
+		return 0, err
+	}
+	return m.syncNodes(ctx, clusterID, client)
+}
+
+// syncNodes 使用已有的客户端同步节点清单
+func (m *ClusterManager) syncNodes(ctx context.Context, clusterID string, client *k8s.Client) (int, error) {
+	nodes, err := client.ListNodes(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("获取节点列表失败: %v", err)
+	}
+
+	records := make([]*models.NodeModel, 0, len(nodes))
+	for i := range nodes {
+		record, err := nodeModelFromK8s(clusterID, &nodes[i])
+		if err != nil {
+			return 0, err
+		}
+		records = append(records, record)
+	}
+
+	if err := m.db.SyncNodes(clusterID, records); err != nil {
+		return 0, fmt.Errorf("保存节点清单失败: %v", err)
+	}
+	return len(records), nil
+}
+
+// ListNodes 获取数据库中保存的集群节点清单
+func (m *ClusterManager) ListNodes(ctx context.Context, clusterID string) ([]*Node, error) {
+	records, err := m.db.ListNodes(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("查询节点列表失败: %v", err)
+	}
+
+	nodes := make([]*Node, 0, len(records))
+	for _, record := range records {
+		node, err := nodeFromModel(record)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// nodeModelFromK8s 将Kubernetes节点转换为数据库模型
+func nodeModelFromK8s(clusterID string, node *corev1.Node) (*models.NodeModel, error) {
+	taints := make([]models.NodeTaint, 0, len(node.Spec.Taints))
+	for _, taint := range node.Spec.Taints {
+		taints = append(taints, models.NodeTaint{
+			Key:    taint.Key,
+			Value:  taint.Value,
+			Effect: string(taint.Effect),
+		})
+	}
+
+	conditions := make([]models.NodeCondition, 0, len(node.Status.Conditions))
+	for _, condition := range node.Status.Conditions {
+		conditions = append(conditions, models.NodeCondition{
+			Type:    string(condition.Type),
+			Status:  string(condition.Status),
+			Reason:  condition.Reason,
+			Message: condition.Message,
+		})
+	}
+
+	now := time.Now()
+	record := &models.NodeModel{
+		Name:      node.Name,
+		ClusterID: clusterID,
+		Status:    nodeStatus(node),
+		Role:      nodeRole(node),
+		IP:        nodeIP(node),
+		Version:   node.Status.NodeInfo.KubeletVersion,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	fields := []struct {
+		name  string
+		value interface{}
+		dst   *string
+	}{
+		{"labels", node.Labels, &record.Labels},
+		{"taints", taints, &record.Taints},
+		{"capacity", resourceList(node.Status.Capacity), &record.Capacity},
+		{"allocatable", resourceList(node.Status.Allocatable), &record.Allocatable},
+		{"conditions", conditions, &record.Conditions},
+	}
+	for _, field := range fields {
+		data, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, fmt.Errorf("序列化节点 %s 的 %s 失败: %v", node.Name, field.name, err)
+		}
+		*field.dst = string(data)
+	}
+
+	return record, nil
+}
+
+// nodeFromModel 将数据库模型转换为节点对象
+func nodeFromModel(record *models.NodeModel) (*Node, error) {
+	node := &Node{
+		Name:      record.Name,
+		ClusterID: record.ClusterID,
+		Status:    record.Status,
+		Role:      record.Role,
+		IP:        record.IP,
+		Version:   record.Version,
+		UpdatedAt: record.UpdatedAt,
+	}
+
+	fields := []struct {
+		name  string
+		value string
+		dst   interface{}
+	}{
+		{"labels", record.Labels, &node.Labels},
+		{"taints", record.Taints, &node.Taints},
+		{"capacity", record.Capacity, &node.Capacity},
+		{"allocatable", record.Allocatable, &node.Allocatable},
+		{"conditions", record.Conditions, &node.Conditions},
+	}
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(field.value), field.dst); err != nil {
+			return nil, fmt.Errorf("解析节点 %s 的 %s 失败: %v", record.Name, field.name, err)
+		}
+	}
+
+	return node, nil
+}
+
+// nodeStatus 返回与kubectl一致的节点状态
+func nodeStatus(node *corev1.Node) string {
+	status := "NotReady"
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady && condition.Status == corev1.ConditionTrue {
+			status = "Ready"
+		}
+	}
+	if node.Spec.Unschedulable {
+		status += ",SchedulingDisabled"
+	}
+	return status
+}
+
+// nodeRole 根据node-role标签返回节点角色，多个角色以逗号分隔
+func nodeRole(node *corev1.Node) string {
+	roles := make([]string, 0)
+	for label := range node.Labels {
+		if role := strings.TrimPrefix(label, nodeRoleLabelPrefix); role != label && role != "" {
+			roles = append(roles, role)
+		}
+	}
+	if len(roles) == 0 {
+		return defaultNodeRole
+	}
+	sort.Strings(roles)
+	return strings.Join(roles, ",")
+}
+
+// nodeIP 返回节点的内部IP，没有时返回第一个地址
+func nodeIP(node *corev1.Node) string {
+	for _, address := range node.Status.Addresses {
+		if address.Type == corev1.NodeInternalIP {
+			return address.Address
+		}
+	}
+	if len(node.Status.Addresses) > 0 {
+		return node.Status.Addresses[0].Address
+	}
+	return ""
+}
+
+// resourceList 将资源列表转换为字符串形式
+func resourceList(resources corev1.ResourceList) map[string]string {
+	result := make(map[string]string, len(resources))
+	for name, quantity := range resources {
+		result[string(name)] = quantity.String()
+	}
+	return result
+}
@@ -0,0 +1,319 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	// ErrApplicationNotFound 应用不存在
+	ErrApplicationNotFound = errors.New("应用不存在")
+	// ErrRevisionNotFound 修订版本不存在
+	ErrRevisionNotFound = errors.New("修订版本不存在")
+	// ErrRevisionNotDeployed 修订版本未部署成功，不能回滚到该版本
+	ErrRevisionNotDeployed = errors.New("修订版本未部署成功，不能回滚到该版本")
+)
+
+// Application 部署到集群中的应用，同一集群和命名空间下按名称区分
+// 每次交付结束后为应用生成一个新的修订版本
+type Application struct {
+	ID          string       `json:"id" gorm:"primaryKey"`
+	Name        string       `json:"name" gorm:"uniqueIndex:idx_application"`
+	ClusterID   string       `json:"cluster_id" gorm:"uniqueIndex:idx_application"`
+	ClusterName string       `json:"cluster_name"`
+	Namespace   string       `json:"namespace" gorm:"uniqueIndex:idx_application"`
+	Type        DeliveryType `json:"type"`
+	// LatestRevision 最新的修订版本号
+	LatestRevision int       `json:"latest_revision"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Revision 应用的一个修订版本，保存交付时渲染的资源清单或Chart和值，以及交付结果
+type Revision struct {
+	ID            uint   `json:"-" gorm:"primaryKey"`
+	ApplicationID string `json:"application_id" gorm:"uniqueIndex:idx_revision"`
+	// Revision 应用内从1开始递增的版本号
+	Revision int            `json:"revision" gorm:"uniqueIndex:idx_revision"`
+	TaskID   string         `json:"task_id"`
+	Type     DeliveryType   `json:"type"`
+	Status   DeliveryStatus `json:"status"`
+	Message  string         `json:"message" gorm:"type:text"`
+	// RollbackOf 回滚生成的修订版本对应的源版本号
+	RollbackOf int `json:"rollback_of,omitempty"`
+	// Config 部署选项，Helm部署时包含Chart和值，接口只返回脱敏后的options
+	Config string `json:"-" gorm:"type:text;serializer:encrypted"`
+	// Manifests 渲染后的资源清单，YAML和Kustomize部署时保存
+	Manifests string    `json:"manifests,omitempty" gorm:"type:text;serializer:encrypted"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MarshalJSON 序列化修订版本，部署选项脱敏后作为options返回
+func (r Revision) MarshalJSON() ([]byte, error) {
+	type revision Revision
+	return json.Marshal(struct {
+		revision
+		Options map[string]interface{} `json:"options,omitempty"`
+	}{revision(r), sanitizeOptions(r.Config)})
+}
+
+// MaskManifests 屏蔽资源清单中所有Secret的数据
+func MaskManifests(manifests string) (string, error) {
+	objects, err := NewManifestReader(strings.NewReader(manifests), "manifests").ReadAll()
+	if err != nil {
+		return "", err
+	}
+
+	var masked strings.Builder
+	for _, manifest := range objects {
+		obj := manifest.Object
+		if gk := obj.GroupVersionKind().GroupKind(); gk.Group == "" && gk.Kind == "Secret" {
+			MaskSecretData(obj, nil)
+		}
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return "", fmt.Errorf("%s: 序列化资源失败: %v", manifest.Position(), err)
+		}
+		masked.WriteString("---\n")
+		masked.Write(data)
+	}
+	return masked.String(), nil
+}
+
+// newApplicationID 生成应用ID
+func newApplicationID() (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", fmt.Errorf("生成应用ID失败: %v", err)
+	}
+	return "app-" + id.String(), nil
+}
+
+// recordRevision 交付结束后为任务所属的应用保存一个新的修订版本，应用不存在时创建
+func (m *Manager) recordRevision(task *DeliveryTask, manifests string) error {
+	// 同一应用的版本号需要串行分配
+	m.revisionMu.Lock()
+	defer m.revisionMu.Unlock()
+
+	return m.storageFactory.GetDB().Transaction(func(tx *gorm.DB) error {
+		var app Application
+		err := tx.Where("cluster_id = ? AND namespace = ? AND name = ?", task.ClusterID, task.Namespace, task.Name).
+			First(&app).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if app.ID, err = newApplicationID(); err != nil {
+				return err
+			}
+			app.Name, app.ClusterID, app.Namespace = task.Name, task.ClusterID, task.Namespace
+			app.CreatedAt = time.Now()
+		} else if err != nil {
+			return fmt.Errorf("查询应用失败: %v", err)
+		}
+
+		app.ClusterName = task.ClusterName
+		app.Type = task.Type
+		app.LatestRevision++
+		app.UpdatedAt = time.Now()
+		if err := tx.Save(&app).Error; err != nil {
+			return fmt.Errorf("保存应用失败: %v", err)
+		}
+
+		revision := &Revision{
+			ApplicationID: app.ID,
+			Revision:      app.LatestRevision,
+			TaskID:        task.ID,
+			Type:          task.Type,
+			Status:        task.Status,
+			Message:       task.Message,
+			RollbackOf:    task.RollbackOf,
+			Config:        task.Config,
+			Manifests:     manifests,
+			CreatedAt:     time.Now(),
+		}
+		if err := tx.Create(revision).Error; err != nil {
+			return fmt.Errorf("保存修订版本失败: %v", err)
+		}
+		return nil
+	})
+}
+
+// GetApplication 获取应用
+func (m *Manager) GetApplication(ctx context.Context, id string) (*Application, error) {
+	var app Application
+	if err := m.storageFactory.GetDB().WithContext(ctx).First(&app, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrApplicationNotFound
+		}
+		return nil, fmt.Errorf("查询应用失败: %v", err)
+	}
+	return &app, nil
+}
+
+// ListApplications 查询应用，clusterID和namespace为空时不过滤
+func (m *Manager) ListApplications(ctx context.Context, clusterID, namespace string) ([]*Application, error) {
+	query := m.storageFactory.GetDB().WithContext(ctx).Model(&Application{})
+	if clusterID != "" {
+		query = query.Where("cluster_id = ?", clusterID)
+	}
+	if namespace != "" {
+		query = query.Where("namespace = ?", namespace)
+	}
+
+	var apps []*Application
+	if err := query.Order("cluster_id, namespace, name").Find(&apps).Error; err != nil {
+		return nil, fmt.Errorf("查询应用失败: %v", err)
+	}
+	return apps, nil
+}
+
+// ListRevisions 按版本号倒序查询应用的修订版本，不包含资源清单
+func (m *Manager) ListRevisions(ctx context.Context, applicationID string) ([]*Revision, error) {
+	if _, err := m.GetApplication(ctx, applicationID); err != nil {
+		return nil, err
+	}
+
+	var revisions []*Revision
+	err := m.storageFactory.GetDB().WithContext(ctx).
+		Omit("manifests").
+		Where("application_id = ?", applicationID).
+		Order("revision DESC").
+		Find(&revisions).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询修订版本失败: %v", err)
+	}
+	return revisions, nil
+}
+
+// GetRevision 获取应用的修订版本，包含资源清单
+func (m *Manager) GetRevision(ctx context.Context, applicationID string, revision int) (*Revision, error) {
+	var rev Revision
+	err := m.storageFactory.GetDB().WithContext(ctx).
+		Where("application_id = ? AND revision = ?", applicationID, revision).
+		First(&rev).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询修订版本失败: %v", err)
+	}
+	return &rev, nil
+}
+
+// Rollback 重新应用指定修订版本保存的资源清单或Chart和值，生成一个新的修订版本
+// YAML和Kustomize应用会清理该修订版本不包含的资源
+func (m *Manager) Rollback(ctx context.Context, applicationID string, revision int) (*DeliveryTask, error) {
+	app, err := m.GetApplication(ctx, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	rev, err := m.GetRevision(ctx, applicationID, revision)
+	if err != nil {
+		return nil, err
+	}
+	if rev.Status != StatusSuccess && rev.Status != StatusRolledBack {
+		return nil, ErrRevisionNotDeployed
+	}
+
+	options, err := rollbackOptions(rev)
+	if err != nil {
+		return nil, err
+	}
+	task, err := newTask(rev.Type, app.Name, app.ClusterID, app.ClusterName, app.Namespace, options)
+	if err != nil {
+		return nil, err
+	}
+	task.RollbackOf = rev.Revision
+
+	// 保存任务到数据库并加入执行队列
+	return m.submitTask(ctx, task)
+}
+
+// rollbackOptions 返回回滚任务的部署选项，YAML和Kustomize应用强制开启清理
+func rollbackOptions(rev *Revision) (interface{}, error) {
+	switch rev.Type {
+	case TypeYAML:
+		var options YAMLOptions
+		if err := decodeRevisionConfig(rev, &options); err != nil {
+			return nil, err
+		}
+		options.Prune, options.PruneDryRun = true, false
+		return &options, nil
+	case TypeKustomize:
+		var options KustomizeOptions
+		if err := decodeRevisionConfig(rev, &options); err != nil {
+			return nil, err
+		}
+		options.Prune, options.PruneDryRun = true, false
+		return &options, nil
+	case TypeHelm:
+		var options HelmOptions
+		if err := decodeRevisionConfig(rev, &options); err != nil {
+			return nil, err
+		}
+		return &options, nil
+	}
+	return nil, fmt.Errorf("不支持的交付类型: %s", rev.Type)
+}
+
+// decodeRevisionConfig 解析修订版本保存的部署选项
+func decodeRevisionConfig(rev *Revision, options interface{}) error {
+	if err := json.Unmarshal([]byte(rev.Config), options); err != nil {
+		return fmt.Errorf("解析修订版本 %d 的部署选项失败: %v", rev.Revision, err)
+	}
+	return nil
+}
+
+// revisionApplyOptions YAML和Kustomize部署选项中与应用资源相关的部分
+type revisionApplyOptions struct {
+	ConflictPolicy ConflictPolicy `json:"conflict_policy"`
+	Wait           bool           `json:"wait"`
+	Timeout        int            `json:"timeout"`
+}
+
+// applyRevision 回滚时直接应用修订版本保存的资源清单，不重新渲染
+func (m *Manager) applyRevision(ctx context.Context, task *DeliveryTask) error {
+	logger := LoggerFromContext(ctx)
+
+	var options revisionApplyOptions
+	if err := DecodeOptions(task, &options); err != nil {
+		return err
+	}
+
+	var app Application
+	err := m.storageFactory.GetDB().WithContext(ctx).
+		Where("cluster_id = ? AND namespace = ? AND name = ?", task.ClusterID, task.Namespace, task.Name).
+		First(&app).Error
+	if err != nil {
+		return fmt.Errorf("查询应用失败: %v", err)
+	}
+	rev, err := m.GetRevision(ctx, app.ID, task.RollbackOf)
+	if err != nil {
+		return err
+	}
+	logger.Infof(LogSourceApply, "回滚到修订版本 %d", rev.Revision)
+
+	clientset, dynamicClient, _, err := m.credentials.Clients(task.ClusterID)
+	if err != nil {
+		return fmt.Errorf("获取Kubernetes客户端失败: %v", err)
+	}
+
+	applier := NewApplier(clientset, dynamicClient, task.Namespace, options.ConflictPolicy)
+	reader := NewManifestReader(strings.NewReader(rev.Manifests), fmt.Sprintf("revision-%d", rev.Revision))
+	if err := applier.Apply(ctx, reader); err != nil {
+		return fmt.Errorf("应用修订版本 %d 失败: %v", rev.Revision, err)
+	}
+
+	if options.Wait {
+		if err := applier.WaitForReady(ctx, time.Duration(options.Timeout)*time.Second); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package delivery
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMaskManifests(t *testing.T) {
+	manifests := "---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\ndata:\n  key: visible\n" +
+		"---\napiVersion: v1\nkind: Secret\nmetadata:\n  name: secret\ndata:\n  password: c2VjcmV0\nstringData:\n  token: plain\n"
+
+	masked, err := MaskManifests(manifests)
+	if err != nil {
+		t.Fatalf("MaskManifests() error = %v", err)
+	}
+	for _, leaked := range []string{"c2VjcmV0", "plain"} {
+		if strings.Contains(masked, leaked) {
+			t.Errorf("MaskManifests() leaked %q:\n%s", leaked, masked)
+		}
+	}
+	if !strings.Contains(masked, "key: visible") {
+		t.Errorf("MaskManifests() masked ConfigMap data:\n%s", masked)
+	}
+
+	objects, err := NewManifestReader(strings.NewReader(masked), "masked").ReadAll()
+	if err != nil || len(objects) != 2 {
+		t.Fatalf("masked manifests are not readable: %d objects, error = %v", len(objects), err)
+	}
+}
+
+func TestMaskManifestsInvalid(t *testing.T) {
+	if _, err := MaskManifests("apiVersion: v1\nmetadata:\n  name: a\n"); err == nil {
+		t.Error("MaskManifests() error = nil, want error for manifest without kind")
+	}
+}
+
+func TestRevisionMarshalJSON(t *testing.T) {
+	rev := Revision{
+		Revision: 1,
+		Type:     TypeHelm,
+		Config:   `{"name":"app","chart_name":"nginx","values":"password: secret"}`,
+	}
+
+	data, err := json.Marshal(rev)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if _, ok := got["config"]; ok {
+		t.Errorf("revision JSON contains config: %s", data)
+	}
+	options, _ := got["options"].(map[string]interface{})
+	if options["chart_name"] != "nginx" {
+		t.Errorf("options = %v, want chart_name", options)
+	}
+	if _, ok := options["values"]; ok {
+		t.Errorf("options contain values: %s", data)
+	}
+}
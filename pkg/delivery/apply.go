@@ -0,0 +1,247 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// FieldManager 服务端应用时使用的字段管理者名称
+const FieldManager = "kde"
+
+// ConflictPolicy 服务端应用遇到字段所有权冲突时的处理方式
+type ConflictPolicy string
+
+const (
+	// ConflictForce 强制接管冲突字段
+	ConflictForce ConflictPolicy = "force"
+	// ConflictFail 遇到冲突时任务失败
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictReport 跳过冲突的资源并记录冲突，其余资源继续应用
+	ConflictReport ConflictPolicy = "report"
+)
+
+// conflictManagerPattern 匹配冲突信息中的字段管理者
+var conflictManagerPattern = regexp.MustCompile(`conflict with "([^"]+)"`)
+
+// Valid 冲突策略是否有效，空值使用默认的force
+func (p ConflictPolicy) Valid() bool {
+	switch p {
+	case "", ConflictForce, ConflictFail, ConflictReport:
+		return true
+	}
+	return false
+}
+
+// FieldConflict 一个字段的所有权冲突
+type FieldConflict struct {
+	// Manager 当前拥有该字段的字段管理者
+	Manager string `json:"manager"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ApplyError 单个资源应用失败的原因
+type ApplyError struct {
+	Kind      string          `json:"kind"`
+	Namespace string          `json:"namespace,omitempty"`
+	Name      string          `json:"name"`
+	Position  string          `json:"position,omitempty"`
+	Message   string          `json:"message"`
+	Conflicts []FieldConflict `json:"conflicts,omitempty"`
+}
+
+// Error 实现error接口
+func (e *ApplyError) Error() string {
+	ref := e.Name
+	if e.Namespace != "" {
+		ref = e.Namespace + "/" + e.Name
+	}
+	return fmt.Sprintf("%s: 应用资源 %s %s 失败: %s", e.Position, e.Kind, ref, e.Message)
+}
+
+// newApplyError 根据应用资源返回的错误创建ApplyError，解析其中的字段冲突
+func newApplyError(manifest *Manifest, err error) *ApplyError {
+	obj := manifest.Object
+	applyErr := &ApplyError{
+		Kind:      obj.GetKind(),
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Position:  manifest.Position(),
+		Message:   err.Error(),
+	}
+
+	var status apierrors.APIStatus
+	if !apierrors.IsConflict(err) || !errors.As(err, &status) || status.Status().Details == nil {
+		return applyErr
+	}
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+		conflict := FieldConflict{Field: cause.Field, Message: cause.Message}
+		if match := conflictManagerPattern.FindStringSubmatch(cause.Message); match != nil {
+			conflict.Manager = match[1]
+		}
+		applyErr.Conflicts = append(applyErr.Conflicts, conflict)
+	}
+	return applyErr
+}
+
+// Applier 使用服务端应用将资源清单提交到集群，YAML和Kustomize后端共用
+type Applier struct {
+	dynamicClient dynamic.Interface
+	mapper        *resourceMapper
+	// namespace 未指定命名空间的命名空间级资源使用的命名空间
+	namespace string
+	policy    ConflictPolicy
+	// applied 已应用的资源，用于等待资源就绪
+	applied []appliedResource
+}
+
+// appliedResource 已应用的资源及其客户端
+type appliedResource struct {
+	object *unstructured.Unstructured
+	client dynamic.ResourceInterface
+}
+
+// NewApplier 创建资源应用器
+func NewApplier(clientset kubernetes.Interface, dynamicClient dynamic.Interface, namespace string, policy ConflictPolicy) *Applier {
+	if policy == "" {
+		policy = ConflictForce
+	}
+	return &Applier{
+		dynamicClient: dynamicClient,
+		mapper:        newResourceMapper(clientset.Discovery()),
+		namespace:     namespace,
+		policy:        policy,
+	}
+}
+
+// Apply 应用读取器中的所有资源
+// 资源按应用批次和类型优先级排序，CRD就绪后才应用之后的资源；
+// 冲突策略为report时，存在冲突的资源被跳过并记录到任务中，不影响任务结果
+func (a *Applier) Apply(ctx context.Context, reader *ManifestReader) error {
+	logger := LoggerFromContext(ctx)
+
+	manifests, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+	if err := SortManifests(manifests); err != nil {
+		return err
+	}
+	if err := recordRendered(ctx, manifests); err != nil {
+		return err
+	}
+
+	var conflicts []*ApplyError
+	var pendingCRDs []string
+	for _, manifest := range manifests {
+		gvk := manifest.Object.GroupVersionKind()
+		if len(pendingCRDs) > 0 && !isCRD(gvk) {
+			if err := a.waitForCRDs(ctx, pendingCRDs); err != nil {
+				return err
+			}
+			pendingCRDs = nil
+		}
+
+		applied, err := a.applyManifest(ctx, manifest)
+		if err != nil {
+			applyErr := newApplyError(manifest, err)
+			if len(applyErr.Conflicts) > 0 && a.policy == ConflictReport {
+				logger.Errorf(LogSourceApply, "资源 %s %s 存在字段冲突，已跳过: %s", applyErr.Kind, objectRef(manifest.Object), conflictFields(applyErr))
+				conflicts = append(conflicts, applyErr)
+				continue
+			}
+			logger.Errorf(LogSourceApply, "应用资源 %s %s 失败: %v", applyErr.Kind, objectRef(manifest.Object), err)
+			RecordApplyErrors(ctx, applyErr)
+			return applyErr
+		}
+
+		logger.Infof(LogSourceApply, "已应用资源 %s %s", applied.GetKind(), objectRef(applied))
+		RecordApplied(ctx, applied)
+
+		// 自定义资源依赖同一批资源中的CRD
+		if isCRD(gvk) {
+			pendingCRDs = append(pendingCRDs, applied.GetName())
+		}
+	}
+
+	if len(conflicts) > 0 {
+		RecordApplyErrors(ctx, conflicts...)
+		logger.Infof(LogSourceApply, "%d 个资源存在字段冲突未应用", len(conflicts))
+	}
+
+	// 跳过的冲突资源仍属于应用，不能被清理
+	recordDesired(ctx, manifests)
+	return nil
+}
+
+// applyManifest 解析资源的GVR和作用域，并通过服务端应用提交
+func (a *Applier) applyManifest(ctx context.Context, manifest *Manifest) (*unstructured.Unstructured, error) {
+	obj := manifest.Object
+	resourceClient, err := a.resourceFor(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := resourceClient.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{
+		FieldManager: FieldManager,
+		Force:        a.policy == ConflictForce,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.applied = append(a.applied, appliedResource{object: applied, client: resourceClient})
+	return applied, nil
+}
+
+// resourceFor 通过服务端发现获取资源的客户端
+// 命名空间级资源未指定命名空间时使用默认命名空间，集群级资源忽略命名空间
+func (a *Applier) resourceFor(obj *unstructured.Unstructured) (dynamic.ResourceInterface, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := a.mapper.RESTMapping(gvk)
+	if err != nil {
+		return nil, fmt.Errorf("获取资源 %s 的映射失败: %v", gvk.Kind, err)
+	}
+
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		obj.SetNamespace("")
+		return a.dynamicClient.Resource(mapping.Resource), nil
+	}
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(a.namespace)
+	}
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(metav1.NamespaceDefault)
+	}
+	return a.dynamicClient.Resource(mapping.Resource).Namespace(obj.GetNamespace()), nil
+}
+
+// conflictFields 返回冲突字段及其管理者的描述
+func conflictFields(applyErr *ApplyError) string {
+	fields := make([]string, 0, len(applyErr.Conflicts))
+	for _, conflict := range applyErr.Conflicts {
+		fields = append(fields, fmt.Sprintf("%s(%s)", conflict.Field, conflict.Manager))
+	}
+	return strings.Join(fields, ", ")
+}
+
+// objectRef 返回资源的namespace/name形式
+func objectRef(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
@@ -0,0 +1,185 @@
+package delivery
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// maxBundleSize 交付包解压后的大小上限
+const maxBundleSize = 100 << 20
+
+// isGzip 判断内容是否为gzip压缩
+func isGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// isManifestFile 判断文件是否为资源清单
+func isManifestFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// ReadManifests 读取上传的资源清单
+// 普通YAML文件直接返回内容；tar.gz包按路径顺序合并其中所有YAML/JSON文件，
+// 每个文件前写入来源标记，解析错误中的位置指向交付包内的文件
+func ReadManifests(data []byte) (string, error) {
+	if !isGzip(data) {
+		return string(data), nil
+	}
+
+	files := make(map[string]string)
+	err := walkBundle(data, func(name string, header *tar.Header, r io.Reader) error {
+		if header.Typeflag != tar.TypeReg || !isManifestFile(name) {
+			return nil
+		}
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %v", name, err)
+		}
+		files[name] = string(content)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("交付包中没有YAML文件")
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var manifests strings.Builder
+	for _, name := range names {
+		manifests.WriteString("---\n")
+		manifests.WriteString(sourceMarker + name + "\n")
+		manifests.WriteString(files[name])
+		if !strings.HasSuffix(files[name], "\n") {
+			manifests.WriteString("\n")
+		}
+	}
+	return manifests.String(), nil
+}
+
+// ExtractBundle 将tar.gz交付包解压到工作目录下的新目录，返回该目录
+func (m *Manager) ExtractBundle(data []byte) (string, error) {
+	if !isGzip(data) {
+		return "", fmt.Errorf("交付包必须为tar.gz格式")
+	}
+
+	dir := filepath.Join(m.workdir, "bundles", uuid.NewString())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("创建交付包目录失败: %v", err)
+	}
+
+	err := walkBundle(data, func(name string, header *tar.Header, r io.Reader) error {
+		target := filepath.Join(dir, name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			return os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = io.Copy(file, r)
+			return err
+		default:
+			// 链接等特殊文件可能指向交付包之外，直接拒绝
+			return fmt.Errorf("交付包中不支持的文件类型: %s", name)
+		}
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// RemoveBundle 删除ExtractBundle解压的目录，不在交付包目录下的路径被忽略
+func (m *Manager) RemoveBundle(dir string) {
+	if dir == "" || filepath.Dir(dir) != filepath.Join(m.workdir, "bundles") {
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		fmt.Printf("删除交付包目录 %s 失败: %v\n", dir, err)
+	}
+}
+
+// BundlePath 解析交付包内的相对路径，拒绝指向交付包之外的路径
+func BundlePath(dir, rel string) (string, error) {
+	if rel == "" {
+		return dir, nil
+	}
+	if filepath.IsAbs(rel) {
+		return "", fmt.Errorf("交付包内路径必须为相对路径: %s", rel)
+	}
+
+	path := filepath.Join(dir, rel)
+	if path != dir && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("路径超出交付包范围: %s", rel)
+	}
+	return path, nil
+}
+
+// WorkdirPath 解析JSON请求中的Chart或Kustomize路径，路径相对于交付工作目录，拒绝指向工作目录之外的路径
+func (m *Manager) WorkdirPath(rel string) (string, error) {
+	workdir, err := filepath.Abs(m.workdir)
+	if err != nil {
+		return "", fmt.Errorf("解析工作目录失败: %v", err)
+	}
+	return BundlePath(workdir, rel)
+}
+
+// walkBundle 遍历tar.gz包中的文件，文件名已清理为安全的相对路径
+func walkBundle(data []byte, fn func(name string, header *tar.Header, r io.Reader) error) error {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("解压交付包失败: %v", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(io.LimitReader(gz, maxBundleSize))
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取交付包失败: %v", err)
+		}
+
+		name := filepath.Clean(header.Name)
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("交付包中包含非法路径: %s", header.Name)
+		}
+		if name == "." {
+			continue
+		}
+
+		if err := fn(name, header, tr); err != nil {
+			return err
+		}
+	}
+}
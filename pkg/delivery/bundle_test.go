@@ -0,0 +1,185 @@
+package delivery
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testBundle 按顺序将文件打包为tar.gz，内容为空的条目使用header中的类型
+func testBundle(t *testing.T, headers []*tar.Header, contents []string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for i, header := range headers {
+		if header.Mode == 0 {
+			header.Mode = 0644
+		}
+		header.Size = int64(len(contents[i]))
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("WriteHeader(%s) error = %v", header.Name, err)
+		}
+		if _, err := tw.Write([]byte(contents[i])); err != nil {
+			t.Fatalf("Write(%s) error = %v", header.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWalkBundle(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "cleaned names",
+			entries: []string{"./", "./base/", "./base/kustomization.yaml", "overlays//prod/../prod/patch.yaml"},
+			want:    []string{"base", "base/kustomization.yaml", "overlays/prod/patch.yaml"},
+		},
+		{
+			name:    "parent directory",
+			entries: []string{"base/kustomization.yaml", "../etc/passwd"},
+			wantErr: true,
+		},
+		{
+			name:    "parent directory after clean",
+			entries: []string{"base/../../secret.yaml"},
+			wantErr: true,
+		},
+		{
+			name:    "absolute path",
+			entries: []string{"/etc/passwd"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := make([]*tar.Header, len(tt.entries))
+			contents := make([]string, len(tt.entries))
+			for i, entry := range tt.entries {
+				headers[i] = &tar.Header{Name: entry, Typeflag: tar.TypeReg}
+				if strings.HasSuffix(entry, "/") {
+					headers[i].Typeflag = tar.TypeDir
+				}
+			}
+
+			var got []string
+			err := walkBundle(testBundle(t, headers, contents), func(name string, header *tar.Header, r io.Reader) error {
+				got = append(got, filepath.ToSlash(name))
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("walkBundle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("walkBundle() names = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkBundleNotGzip(t *testing.T) {
+	err := walkBundle([]byte("apiVersion: v1\n"), func(string, *tar.Header, io.Reader) error { return nil })
+	if err == nil {
+		t.Error("walkBundle() error = nil, want error for plain content")
+	}
+}
+
+func TestExtractBundle(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []*tar.Header
+		wantErr bool
+	}{
+		{
+			name: "regular files",
+			headers: []*tar.Header{
+				{Name: "base/", Typeflag: tar.TypeDir, Mode: 0755},
+				{Name: "base/kustomization.yaml", Typeflag: tar.TypeReg},
+			},
+		},
+		{
+			name: "symlink",
+			headers: []*tar.Header{
+				{Name: "base/kustomization.yaml", Typeflag: tar.TypeReg},
+				{Name: "base/secret.yaml", Typeflag: tar.TypeSymlink, Linkname: "/etc/shadow"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "hard link",
+			headers: []*tar.Header{
+				{Name: "base/kustomization.yaml", Typeflag: tar.TypeReg},
+				{Name: "base/copy.yaml", Typeflag: tar.TypeLink, Linkname: "base/kustomization.yaml"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := &Manager{workdir: t.TempDir()}
+			dir, err := manager.ExtractBundle(testBundle(t, tt.headers, make([]string, len(tt.headers))))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExtractBundle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			entries, _ := os.ReadDir(filepath.Join(manager.workdir, "bundles"))
+			if tt.wantErr {
+				if len(entries) != 0 {
+					t.Errorf("ExtractBundle() left %d directories after failure", len(entries))
+				}
+				return
+			}
+			if _, err := os.Stat(filepath.Join(dir, "base", "kustomization.yaml")); err != nil {
+				t.Errorf("extracted file missing: %v", err)
+			}
+		})
+	}
+}
+
+func TestBundlePath(t *testing.T) {
+	dir := filepath.Join(string(filepath.Separator)+"work", "bundles", "b1")
+	tests := []struct {
+		name    string
+		rel     string
+		want    string
+		wantErr bool
+	}{
+		{name: "empty", rel: "", want: dir},
+		{name: "nested", rel: "overlays/prod", want: filepath.Join(dir, "overlays", "prod")},
+		{name: "dot", rel: ".", want: dir},
+		{name: "inner parent", rel: "overlays/../base", want: filepath.Join(dir, "base")},
+		{name: "absolute", rel: "/etc", wantErr: true},
+		{name: "parent", rel: "../b2", wantErr: true},
+		{name: "sibling prefix", rel: "../b1x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BundlePath(dir, tt.rel)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BundlePath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("BundlePath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package delivery
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/huyouba1/kde/pkg/cluster"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// CredentialProvider 集群凭据提供者，所有交付后端通过它连接 ClusterID 指定的集群
+type CredentialProvider struct {
+	clusterManager *cluster.ClusterManager
+}
+
+// NewCredentialProvider 创建集群凭据提供者
+func NewCredentialProvider(clusterManager *cluster.ClusterManager) *CredentialProvider {
+	return &CredentialProvider{
+		clusterManager: clusterManager,
+	}
+}
+
+// Clients 获取集群的clientset、dynamic客户端和REST配置
+func (p *CredentialProvider) Clients(clusterID string) (*kubernetes.Clientset, dynamic.Interface, *rest.Config, error) {
+	// 必须显式指定集群，不能回退到默认kubeconfig
+	if clusterID == "" {
+		return nil, nil, nil, fmt.Errorf("未指定目标集群")
+	}
+
+	client, err := p.clusterManager.GetClient(clusterID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("获取集群 %s 的客户端失败: %v", clusterID, err)
+	}
+
+	return client.GetClientSet(), client.GetDynamicClient(), client.GetConfig(), nil
+}
+
+// WithKubeconfigFile 将集群凭据写入仅当前用户可读写的临时kubeconfig文件，
+// 在fn执行期间有效，返回前总是删除该文件
+func (p *CredentialProvider) WithKubeconfigFile(clusterID string, fn func(path string) error) error {
+	if clusterID == "" {
+		return fmt.Errorf("未指定目标集群")
+	}
+
+	client, err := p.clusterManager.GetClient(clusterID)
+	if err != nil {
+		return fmt.Errorf("获取集群 %s 的客户端失败: %v", clusterID, err)
+	}
+
+	kubeconfig, err := client.Kubeconfig()
+	if err != nil {
+		return fmt.Errorf("生成kubeconfig失败: %v", err)
+	}
+
+	file, err := os.CreateTemp("", "kde-kubeconfig-*.yaml")
+	if err != nil {
+		return fmt.Errorf("创建临时kubeconfig文件失败: %v", err)
+	}
+	path := file.Name()
+	defer os.Remove(path)
+
+	if err := writeKubeconfig(file, kubeconfig); err != nil {
+		return err
+	}
+
+	return fn(path)
+}
+
+// writeKubeconfig 以0600权限写入kubeconfig并关闭文件
+func writeKubeconfig(file *os.File, kubeconfig []byte) error {
+	defer file.Close()
+
+	if err := file.Chmod(0600); err != nil {
+		return fmt.Errorf("设置kubeconfig文件权限失败: %v", err)
+	}
+	if _, err := file.Write(kubeconfig); err != nil {
+		return fmt.Errorf("写入kubeconfig文件失败: %v", err)
+	}
+	return nil
+}
@@ -2,12 +2,23 @@ package delivery
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/huyouba1/kde/configs"
+	"github.com/huyouba1/kde/pkg/cluster"
 	"github.com/huyouba1/kde/pkg/storage"
 )
 
+// ErrTaskNotCancellable 任务已结束，无法取消
+var ErrTaskNotCancellable = errors.New("交付任务已结束，无法取消")
+
+// cancelWaitTimeout 取消运行中的任务时等待执行器退出的最长时间
+const cancelWaitTimeout = 10 * time.Second
+
 // DeliveryStatus 交付状态
 type DeliveryStatus string
 
@@ -20,8 +31,17 @@ const (
 	StatusSuccess DeliveryStatus = "success"
 	// StatusFailed 失败
 	StatusFailed DeliveryStatus = "failed"
+	// StatusCancelled 已取消
+	StatusCancelled DeliveryStatus = "cancelled"
+	// StatusRolledBack 回滚成功
+	StatusRolledBack DeliveryStatus = "rolled_back"
 )
 
+// Finished 任务是否已结束
+func (s DeliveryStatus) Finished() bool {
+	return s == StatusSuccess || s == StatusFailed || s == StatusCancelled || s == StatusRolledBack
+}
+
 // DeliveryType 交付类型
 type DeliveryType string
 
@@ -34,30 +54,96 @@ const (
 	TypeKustomize DeliveryType = "kustomize"
 )
 
-// DeliveryTask 交付任务
+// DeliveryTask 交付任务，Config包含YAML内容和Helm值，接口只返回脱敏后的部署选项
 type DeliveryTask struct {
 	ID          string         `json:"id" gorm:"primaryKey"`
 	Name        string         `json:"name"`
-	Type        DeliveryType   `json:"type"`
-	Status      DeliveryStatus `json:"status"`
-	ClusterID   string         `json:"cluster_id"`
+	Type        DeliveryType   `json:"type" gorm:"index"`
+	Status      DeliveryStatus `json:"status" gorm:"index"`
+	ClusterID   string         `json:"cluster_id" gorm:"index"`
 	ClusterName string         `json:"cluster_name"`
-	Namespace   string         `json:"namespace"`
+	Namespace   string         `json:"namespace" gorm:"index"`
 	FilePath    string         `json:"file_path"`
-	Config      string         `json:"config" gorm:"type:text"`
+	Config      string         `json:"-" gorm:"type:text;serializer:encrypted"`
 	Message     string         `json:"message" gorm:"type:text"`
-	CreatedAt   time.Time      `json:"created_at"`
+	CreatedAt   time.Time      `json:"created_at" gorm:"index"`
 	UpdatedAt   time.Time      `json:"updated_at"`
+	// Errors 应用失败或存在字段冲突的资源
+	Errors []*ApplyError `json:"errors,omitempty" gorm:"type:text;serializer:json"`
+	// Readiness 开启等待时各资源的就绪状态
+	Readiness []*ObjectReadiness `json:"readiness,omitempty" gorm:"type:text;serializer:json"`
+	// Pruned 清理或预览清理的资源
+	Pruned []*PruneResult `json:"pruned,omitempty" gorm:"type:text;serializer:json"`
+	// BundleDir 上传的交付包解压目录，任务结束后删除
+	BundleDir string `json:"-"`
+	// RollbackOf 回滚任务对应的修订版本号，普通部署为0
+	RollbackOf int `json:"rollback_of,omitempty"`
+	// IdempotencyKey 客户端提供的幂等键，未提供时为NULL
+	IdempotencyKey *string `json:"idempotency_key,omitempty" gorm:"uniqueIndex"`
+	// RequestHash 交付类型和部署选项的摘要，幂等键重复使用时用于比较请求是否相同
+	RequestHash string `json:"-"`
+}
+
+// EncryptedModels 返回包含加密字段的交付模型，轮换主密钥时需要重新加密这些模型
+func EncryptedModels() []interface{} {
+	return []interface{}{&DeliveryTask{}, &Revision{}}
+}
+
+// Executor 交付执行器，各交付后端实现该接口并按交付类型注册到Manager
+type Executor interface {
+	// Type 执行器处理的交付类型
+	Type() DeliveryType
+	// Execute 执行交付任务，部署选项保存在任务的Config中，可通过DecodeOptions解析
+	Execute(ctx context.Context, task *DeliveryTask) error
+}
+
+// DecodeOptions 解析任务保存的部署选项
+func DecodeOptions(task *DeliveryTask, options interface{}) error {
+	if err := json.Unmarshal([]byte(task.Config), options); err != nil {
+		return fmt.Errorf("解析部署选项失败: %v", err)
+	}
+	return nil
+}
+
+// sensitiveOptionFields 部署选项中可能包含Secret等敏感数据的字段
+var sensitiveOptionFields = []string{"content", "values"}
+
+// sanitizeOptions 解析部署选项并移除YAML内容和Helm值，用于接口返回
+func sanitizeOptions(config string) map[string]interface{} {
+	var options map[string]interface{}
+	if err := json.Unmarshal([]byte(config), &options); err != nil {
+		return nil
+	}
+	for _, field := range sensitiveOptionFields {
+		delete(options, field)
+	}
+	return options
+}
+
+// MarshalJSON 序列化交付任务，部署选项脱敏后作为options返回
+func (t DeliveryTask) MarshalJSON() ([]byte, error) {
+	type task DeliveryTask
+	return json.Marshal(struct {
+		task
+		Options map[string]interface{} `json:"options,omitempty"`
+	}{task(t), sanitizeOptions(t.Config)})
 }
 
 // YAMLOptions YAML部署选项
 type YAMLOptions struct {
-	Name        string `json:"name"`
-	ClusterID   string `json:"cluster_id"`
-	ClusterName string `json:"cluster_name"`
-	Namespace   string `json:"namespace"`
-	Content     string `json:"content"`
-	FilePath    string `json:"file_path"`
+	Name        string `json:"name" form:"name"`
+	ClusterID   string `json:"cluster_id" form:"cluster_id"`
+	ClusterName string `json:"cluster_name" form:"cluster_name"`
+	Namespace   string `json:"namespace" form:"namespace"`
+	Content     string `json:"content" form:"content"`
+	FilePath    string `json:"file_path" form:"file_path"`
+	PruneOptions
+	// ConflictPolicy 字段所有权冲突的处理方式，默认为force
+	ConflictPolicy ConflictPolicy `json:"conflict_policy" form:"conflict_policy"`
+	// Wait 应用后等待资源就绪，超时后任务失败
+	Wait bool `json:"wait" form:"wait"`
+	// Timeout 等待资源就绪的超时时间（秒），默认300
+	Timeout int `json:"timeout" form:"timeout"`
 }
 
 // HelmOptions Helm部署选项
@@ -75,180 +161,185 @@ type HelmOptions struct {
 
 // KustomizeOptions Kustomize部署选项
 type KustomizeOptions struct {
-	Name        string `json:"name"`
-	ClusterID   string `json:"cluster_id"`
-	ClusterName string `json:"cluster_name"`
-	Namespace   string `json:"namespace"`
-	BasePath    string `json:"base_path"`
-	OverlayPath string `json:"overlay_path"`
+	Name        string `json:"name" form:"name"`
+	ClusterID   string `json:"cluster_id" form:"cluster_id"`
+	ClusterName string `json:"cluster_name" form:"cluster_name"`
+	Namespace   string `json:"namespace" form:"namespace"`
+	BasePath    string `json:"base_path" form:"base_path"`
+	OverlayPath string `json:"overlay_path" form:"overlay_path"`
+	// BundleDir 上传的交付包解压目录，由服务端设置，不能通过请求指定
+	BundleDir string `json:"-" form:"-"`
+	// BundleDigest 上传的交付包内容的摘要，由服务端设置
+	BundleDigest string `json:"-" form:"-"`
+	PruneOptions
+	// ConflictPolicy 字段所有权冲突的处理方式，默认为force
+	ConflictPolicy ConflictPolicy `json:"conflict_policy" form:"conflict_policy"`
+	// Wait 应用后等待资源就绪，超时后任务失败
+	Wait bool `json:"wait" form:"wait"`
+	// Timeout 等待资源就绪的超时时间（秒），默认300
+	Timeout int `json:"timeout" form:"timeout"`
 }
 
 // Manager 交付管理器
 type Manager struct {
 	storageFactory storage.Factory
 	workdir        string
+	pool           *workerPool
+	logs           *logHub
+	executors      map[DeliveryType]Executor
+	credentials    *CredentialProvider
+	// eventWindow 交付结束后收集事件的时间窗口
+	eventWindow time.Duration
+	// revisionMu 串行分配应用的修订版本号
+	revisionMu sync.Mutex
 }
 
 // NewManager 创建一个新的交付管理器
-func NewManager(factory storage.Factory, workdir string) *Manager {
-	return &Manager{
+func NewManager(factory storage.Factory, cfg *configs.DeliveryConfig, clusterManager *cluster.ClusterManager) (*Manager, error) {
+	// 迁移交付任务表
+	models := append(EncryptedModels(), &TaskLog{}, &TaskEvent{}, &Inventory{}, &Application{})
+	if err := factory.AutoMigrate(models...); err != nil {
+		return nil, fmt.Errorf("迁移交付任务表失败: %v", err)
+	}
+
+	m := &Manager{
 		storageFactory: factory,
-		workdir:        workdir,
+		workdir:        cfg.Workdir,
+		logs:           newLogHub(),
+		executors:      make(map[DeliveryType]Executor),
+		credentials:    NewCredentialProvider(clusterManager),
+		eventWindow:    time.Duration(cfg.EventWindow) * time.Second,
 	}
+	m.pool = newWorkerPool(m, cfg.Workers, cfg.ClusterConcurrency)
+
+	return m, nil
 }
 
-// DeployYAML 部署YAML
-func (m *Manager) DeployYAML(ctx context.Context, options *YAMLOptions) (*DeliveryTask, error) {
-	// 创建交付任务
-	task := &DeliveryTask{
-		ID:          fmt.Sprintf("task-%d", time.Now().Unix()),
-		Name:        options.Name,
-		Type:        TypeYAML,
-		Status:      StatusPending,
-		ClusterID:   options.ClusterID,
-		ClusterName: options.ClusterName,
-		Namespace:   options.Namespace,
-		FilePath:    options.FilePath,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-	}
-
-	// TODO: 保存任务到数据库
-
-	// 异步执行部署
-	go func() {
-		// 更新状态为运行中
-		task.Status = StatusRunning
-		task.UpdatedAt = time.Now()
-		// TODO: 更新任务状态到数据库
-
-		// 执行YAML部署
-		err := m.executeYAMLDeploy(ctx, options)
-		if err != nil {
-			// 更新状态为失败
-			task.Status = StatusFailed
-			task.Message = err.Error()
-		} else {
-			// 更新状态为成功
-			task.Status = StatusSuccess
-			task.Message = "部署成功"
-		}
+// Start 启动任务执行器，上次退出时未完成的任务会重新排队执行
+func (m *Manager) Start(ctx context.Context) error {
+	return m.pool.start(ctx)
+}
+
+// Stop 停止任务执行器
+func (m *Manager) Stop() {
+	m.pool.stop()
+}
+
+// Credentials 返回交付后端共用的集群凭据提供者
+func (m *Manager) Credentials() *CredentialProvider {
+	return m.credentials
+}
 
-		task.UpdatedAt = time.Now()
-		// TODO: 更新任务状态到数据库
-	}()
+// CancelTask 取消交付任务，运行中的任务最多等待cancelWaitTimeout让执行器退出，返回任务的最新状态
+// 执行器未在超时内退出时返回的任务仍处于运行中，任务会在执行器退出后标记为已取消
+func (m *Manager) CancelTask(ctx context.Context, id string) (*DeliveryTask, error) {
+	done, cancelled, err := m.pool.cancelTask(id)
+	if err != nil {
+		return nil, err
+	}
+	if done != nil {
+		select {
+		case <-done:
+		case <-time.After(cancelWaitTimeout):
+		case <-ctx.Done():
+		}
+	}
 
+	task, err := m.GetTask(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !cancelled {
+		return nil, ErrTaskNotCancellable
+	}
+	// 等待中的任务不会再执行，运行中的任务由执行器在结束时删除交付包
+	if task.Status == StatusCancelled {
+		m.RemoveBundle(task.BundleDir)
+	}
 	return task, nil
 }
 
-// executeYAMLDeploy 执行YAML部署
-func (m *Manager) executeYAMLDeploy(ctx context.Context, options *YAMLOptions) error {
-	// TODO: 实现YAML部署逻辑
-	// 1. 获取集群连接信息
-	// 2. 应用YAML到集群
+// RegisterExecutor 注册交付执行器，需要在Start之前调用
+func (m *Manager) RegisterExecutor(executor Executor) error {
+	if _, exists := m.executors[executor.Type()]; exists {
+		return fmt.Errorf("交付类型 %s 的执行器已注册", executor.Type())
+	}
+	m.executors[executor.Type()] = executor
 	return nil
 }
 
-// DeployHelm 部署Helm
-func (m *Manager) DeployHelm(ctx context.Context, options *HelmOptions) (*DeliveryTask, error) {
-	// 创建交付任务
-	task := &DeliveryTask{
-		ID:          fmt.Sprintf("task-%d", time.Now().Unix()),
-		Name:        options.Name,
-		Type:        TypeHelm,
-		Status:      StatusPending,
-		ClusterID:   options.ClusterID,
-		ClusterName: options.ClusterName,
-		Namespace:   options.Namespace,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-	}
-
-	// TODO: 保存任务到数据库
-
-	// 异步执行部署
-	go func() {
-		// 更新状态为运行中
-		task.Status = StatusRunning
-		task.UpdatedAt = time.Now()
-		// TODO: 更新任务状态到数据库
-
-		// 执行Helm部署
-		err := m.executeHelmDeploy(ctx, options)
-		if err != nil {
-			// 更新状态为失败
-			task.Status = StatusFailed
-			task.Message = err.Error()
-		} else {
-			// 更新状态为成功
-			task.Status = StatusSuccess
-			task.Message = "部署成功"
+// execute 根据任务类型分发给对应的交付执行器
+func (m *Manager) execute(ctx context.Context, task *DeliveryTask) error {
+	executor, ok := m.executors[task.Type]
+	if !ok {
+		return fmt.Errorf("不支持的交付类型: %s", task.Type)
+	}
+	var err error
+	if task.RollbackOf > 0 && task.Type.tracksInventory() {
+		// 回滚直接应用修订版本保存的资源清单
+		err = m.applyRevision(ctx, task)
+	} else {
+		err = executor.Execute(ctx, task)
+	}
+
+	// 更新应用的资源清单，取消或服务停止时不更新
+	recorder, ok := ctx.Value(appliedContextKey{}).(*appliedRecorder)
+	if !ok || !task.Type.tracksInventory() || ctx.Err() != nil {
+		return err
+	}
+	if inventoryErr := m.updateInventory(ctx, task, recorder, err); inventoryErr != nil {
+		if err == nil {
+			return inventoryErr
 		}
+		LoggerFromContext(ctx).Errorf(LogSourcePrune, "更新资源清单失败: %v", inventoryErr)
+	}
+	return err
+}
 
-		task.UpdatedAt = time.Now()
-		// TODO: 更新任务状态到数据库
-	}()
+// DeployYAML 部署YAML
+func (m *Manager) DeployYAML(ctx context.Context, options *YAMLOptions) (*DeliveryTask, error) {
+	// 创建交付任务
+	task, err := newTask(TypeYAML, options.Name, options.ClusterID, options.ClusterName, options.Namespace, options)
+	if err != nil {
+		return nil, err
+	}
+	task.FilePath = options.FilePath
 
-	return task, nil
+	// 保存任务到数据库并加入执行队列
+	return m.submitTask(ctx, task)
 }
 
-// executeHelmDeploy 执行Helm部署
-func (m *Manager) executeHelmDeploy(ctx context.Context, options *HelmOptions) error {
-	// TODO: 实现Helm部署逻辑
-	// 1. 获取集群连接信息
-	// 2. 下载或使用本地Chart
-	// 3. 应用Helm Chart到集群
-	return nil
+// DeployHelm 部署Helm
+func (m *Manager) DeployHelm(ctx context.Context, options *HelmOptions) (*DeliveryTask, error) {
+	// 创建交付任务
+	task, err := newTask(TypeHelm, options.Name, options.ClusterID, options.ClusterName, options.Namespace, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// 保存任务到数据库并加入执行队列
+	return m.submitTask(ctx, task)
 }
 
 // DeployKustomize 部署Kustomize
 func (m *Manager) DeployKustomize(ctx context.Context, options *KustomizeOptions) (*DeliveryTask, error) {
 	// 创建交付任务
-	task := &DeliveryTask{
-		ID:          fmt.Sprintf("task-%d", time.Now().Unix()),
-		Name:        options.Name,
-		Type:        TypeKustomize,
-		Status:      StatusPending,
-		ClusterID:   options.ClusterID,
-		ClusterName: options.ClusterName,
-		Namespace:   options.Namespace,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-	}
-
-	// TODO: 保存任务到数据库
-
-	// 异步执行部署
-	go func() {
-		// 更新状态为运行中
-		task.Status = StatusRunning
-		task.UpdatedAt = time.Now()
-		// TODO: 更新任务状态到数据库
-
-		// 执行Kustomize部署
-		err := m.executeKustomizeDeploy(ctx, options)
-		if err != nil {
-			// 更新状态为失败
-			task.Status = StatusFailed
-			task.Message = err.Error()
-		} else {
-			// 更新状态为成功
-			task.Status = StatusSuccess
-			task.Message = "部署成功"
-		}
-
-		task.UpdatedAt = time.Now()
-		// TODO: 更新任务状态到数据库
-	}()
-
-	return task, nil
-}
+	task, err := newTask(TypeKustomize, options.Name, options.ClusterID, options.ClusterName, options.Namespace, options)
+	if err != nil {
+		m.RemoveBundle(options.BundleDir)
+		return nil, err
+	}
+	task.BundleDir = options.BundleDir
+	if options.BundleDir != "" {
+		// 交付包每次解压到不同的目录，按包内容和包内的相对路径识别相同的请求
+		task.RequestHash = bundleRequestHash(options)
+	}
 
-// executeKustomizeDeploy 执行Kustomize部署
-func (m *Manager) executeKustomizeDeploy(ctx context.Context, options *KustomizeOptions) error {
-	// TODO: 实现Kustomize部署逻辑
-	// 1. 获取集群连接信息
-	// 2. 使用kustomize构建资源
-	// 3. 应用资源到集群
-	return nil
+	// 保存任务到数据库并加入执行队列
+	submitted, err := m.submitTask(ctx, task)
+	if err != nil || submitted.ID != task.ID {
+		// 提交失败或幂等键命中已有任务时，本次上传的交付包不会被使用
+		m.RemoveBundle(options.BundleDir)
+	}
+	return submitted, err
 }
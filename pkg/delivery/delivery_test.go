@@ -0,0 +1,53 @@
+package delivery
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDeliveryTaskMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		wantOptions map[string]interface{}
+	}{
+		{
+			name:        "yaml content removed",
+			config:      `{"name":"app","content":"kind: Secret","wait":true}`,
+			wantOptions: map[string]interface{}{"name": "app", "wait": true},
+		},
+		{
+			name:        "helm values removed",
+			config:      `{"name":"app","chart_name":"nginx","values":{"password":"secret"}}`,
+			wantOptions: map[string]interface{}{"name": "app", "chart_name": "nginx"},
+		},
+		{
+			name:   "invalid config omitted",
+			config: "not json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(&DeliveryTask{ID: "task-1", Config: tt.config})
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			var got struct {
+				ID      string                 `json:"id"`
+				Config  *string                `json:"config"`
+				Options map[string]interface{} `json:"options"`
+			}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if got.ID != "task-1" || got.Config != nil {
+				t.Errorf("Marshal() = %s, want id without config", data)
+			}
+			if !reflect.DeepEqual(got.Options, tt.wantOptions) {
+				t.Errorf("options = %v, want %v", got.Options, tt.wantOptions)
+			}
+		})
+	}
+}
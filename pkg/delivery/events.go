@@ -0,0 +1,506 @@
+package delivery
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huyouba1/kde/pkg/k8s"
+	"gorm.io/gorm/clause"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// eventPollInterval 收集事件的轮询间隔
+	eventPollInterval = 10 * time.Second
+	// clusterEventNamespace 集群级资源的事件所在的命名空间
+	clusterEventNamespace = metav1.NamespaceDefault
+)
+
+// AppliedObject 交付时应用到集群的资源
+type AppliedObject struct {
+	APIVersion string    `json:"api_version"`
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid,omitempty"`
+}
+
+// TaskEvent 交付任务关联的Kubernetes事件
+// 同一资源上类型、原因和消息相同的事件合并为一条，累计次数并保留最后发生时间
+type TaskEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	TaskID    string    `json:"task_id" gorm:"uniqueIndex:idx_task_event"`
+	Key       string    `json:"-" gorm:"uniqueIndex:idx_task_event;size:64"`
+	Namespace string    `json:"namespace"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message" gorm:"type:text"`
+	Count     int32     `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen" gorm:"index"`
+}
+
+// appliedContextKey 已应用资源记录在上下文中的键
+type appliedContextKey struct{}
+
+// appliedRecorder 记录单个任务应用的资源、应用失败的资源、资源的就绪状态和清理结果
+type appliedRecorder struct {
+	mu        sync.Mutex
+	objects   []AppliedObject
+	errors    []*ApplyError
+	readiness []*ObjectReadiness
+	pruned    []*PruneResult
+	// desired 清单中的全部资源，全部处理完成后才记录
+	desired         []InventoryObject
+	desiredRecorded bool
+	// rendered 渲染后的资源清单，用于保存修订版本
+	rendered string
+}
+
+// withAppliedRecorder 在上下文中附加已应用资源的记录
+func withAppliedRecorder(ctx context.Context) (context.Context, *appliedRecorder) {
+	recorder := &appliedRecorder{}
+	return context.WithValue(ctx, appliedContextKey{}, recorder), recorder
+}
+
+// RecordApplied 记录应用到集群的资源，交付结束后收集这些资源的事件
+func RecordApplied(ctx context.Context, obj *unstructured.Unstructured) {
+	recorder, ok := ctx.Value(appliedContextKey{}).(*appliedRecorder)
+	if !ok || obj == nil {
+		return
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.objects = append(recorder.objects, AppliedObject{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		UID:        obj.GetUID(),
+	})
+}
+
+// RecordApplyErrors 记录应用失败的资源，任务结束时保存到任务的Errors中
+func RecordApplyErrors(ctx context.Context, errs ...*ApplyError) {
+	recorder, ok := ctx.Value(appliedContextKey{}).(*appliedRecorder)
+	if !ok {
+		return
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.errors = append(recorder.errors, errs...)
+}
+
+// RecordReadiness 记录资源的就绪状态，任务结束时保存到任务的Readiness中
+func RecordReadiness(ctx context.Context, report ...*ObjectReadiness) {
+	recorder, ok := ctx.Value(appliedContextKey{}).(*appliedRecorder)
+	if !ok {
+		return
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.readiness = append(recorder.readiness, report...)
+}
+
+// RecordPrune 记录资源清理结果，任务结束时保存到任务的Pruned中
+func RecordPrune(ctx context.Context, results ...*PruneResult) {
+	recorder, ok := ctx.Value(appliedContextKey{}).(*appliedRecorder)
+	if !ok {
+		return
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.pruned = append(recorder.pruned, results...)
+}
+
+// recordDesired 记录本次交付清单中的全部资源，作为应用的新资源清单
+func recordDesired(ctx context.Context, manifests []*Manifest) {
+	recorder, ok := ctx.Value(appliedContextKey{}).(*appliedRecorder)
+	if !ok {
+		return
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	for _, manifest := range manifests {
+		obj := manifest.Object
+		recorder.desired = append(recorder.desired, inventoryObjectFor(obj.GetAPIVersion(), obj.GetKind(), obj.GetNamespace(), obj.GetName()))
+	}
+	recorder.desiredRecorded = true
+}
+
+// recordRendered 记录渲染后的资源清单，修订版本保存该清单用于回滚
+func recordRendered(ctx context.Context, manifests []*Manifest) error {
+	recorder, ok := ctx.Value(appliedContextKey{}).(*appliedRecorder)
+	if !ok {
+		return nil
+	}
+
+	var rendered strings.Builder
+	for _, manifest := range manifests {
+		data, err := yaml.Marshal(manifest.Object.Object)
+		if err != nil {
+			return fmt.Errorf("%s: 序列化资源失败: %v", manifest.Position(), err)
+		}
+		rendered.WriteString("---\n")
+		rendered.Write(data)
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.rendered = rendered.String()
+	return nil
+}
+
+// desiredObjects 返回本次交付清单中的全部资源，清单未处理完成时返回false
+func (r *appliedRecorder) desiredObjects() ([]InventoryObject, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]InventoryObject(nil), r.desired...), r.desiredRecorded
+}
+
+// appliedInventory 返回已应用的资源
+func (r *appliedRecorder) appliedInventory() []InventoryObject {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	objects := make([]InventoryObject, 0, len(r.objects))
+	for _, obj := range r.objects {
+		objects = append(objects, inventoryObjectFor(obj.APIVersion, obj.Kind, obj.Namespace, obj.Name))
+	}
+	return objects
+}
+
+// pruneResults 返回记录的资源清理结果
+func (r *appliedRecorder) pruneResults() []*PruneResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*PruneResult(nil), r.pruned...)
+}
+
+// readinessReport 返回记录的资源就绪状态
+func (r *appliedRecorder) readinessReport() []*ObjectReadiness {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*ObjectReadiness(nil), r.readiness...)
+}
+
+// applyErrors 返回记录的应用失败的资源
+func (r *appliedRecorder) applyErrors() []*ApplyError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*ApplyError(nil), r.errors...)
+}
+
+// renderedManifests 返回渲染后的资源清单
+func (r *appliedRecorder) renderedManifests() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rendered
+}
+
+// list 返回记录的资源
+func (r *appliedRecorder) list() []AppliedObject {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]AppliedObject(nil), r.objects...)
+}
+
+// ListTaskEvents 获取任务关联的事件，按最后发生时间倒序
+func (m *Manager) ListTaskEvents(ctx context.Context, taskID string) ([]*TaskEvent, error) {
+	if _, err := m.GetTask(ctx, taskID); err != nil {
+		return nil, err
+	}
+
+	events := make([]*TaskEvent, 0)
+	err := m.storageFactory.GetDB().WithContext(ctx).
+		Where("task_id = ?", taskID).
+		Order("last_seen DESC").
+		Find(&events).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询任务事件失败: %v", err)
+	}
+	return events, nil
+}
+
+// eventCollector 在时间窗口内收集交付资源及其下属Pod等资源的事件
+type eventCollector struct {
+	manager       *Manager
+	task          *DeliveryTask
+	objects       []AppliedObject
+	clientset     *kubernetes.Clientset
+	dynamicClient dynamic.Interface
+	// since 任务开始执行的时间，之前发生的事件属于以前的交付
+	since time.Time
+
+	// seen 每条合并事件中各原始事件的次数，原始事件被重建时累计次数
+	seen map[string]map[types.UID]int32
+}
+
+// collectEvents 交付结束后在配置的时间窗口内轮询收集事件
+func (m *Manager) collectEvents(ctx context.Context, task *DeliveryTask, since time.Time, objects []AppliedObject) {
+	if m.eventWindow <= 0 || len(objects) == 0 {
+		return
+	}
+
+	clientset, dynamicClient, _, err := m.credentials.Clients(task.ClusterID)
+	if err != nil {
+		fmt.Printf("任务 %s: 收集事件失败: %v\n", task.ID, err)
+		return
+	}
+
+	c := &eventCollector{
+		manager:       m,
+		task:          task,
+		objects:       objects,
+		clientset:     clientset,
+		dynamicClient: dynamicClient,
+		since:         since,
+		seen:          make(map[string]map[types.UID]int32),
+	}
+	c.resolveObjects(ctx)
+
+	ctx, cancel := context.WithTimeout(ctx, m.eventWindow)
+	defer cancel()
+
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.poll(ctx); err != nil && ctx.Err() == nil {
+			fmt.Printf("任务 %s: 收集事件失败: %v\n", task.ID, err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// resolveObjects 补全资源的命名空间和UID，Helm等后端只能记录资源名称
+func (c *eventCollector) resolveObjects(ctx context.Context) {
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(c.clientset.Discovery()))
+
+	for i := range c.objects {
+		obj := &c.objects[i]
+		if obj.UID != "" {
+			continue
+		}
+
+		gv, err := schema.ParseGroupVersion(obj.APIVersion)
+		if err != nil {
+			continue
+		}
+		mapping, err := mapper.RESTMapping(gv.WithKind(obj.Kind).GroupKind(), gv.Version)
+		if err != nil {
+			continue
+		}
+
+		var resource dynamic.ResourceInterface = c.dynamicClient.Resource(mapping.Resource)
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			if obj.Namespace == "" {
+				obj.Namespace = c.task.Namespace
+			}
+			if obj.Namespace == "" {
+				obj.Namespace = metav1.NamespaceDefault
+			}
+			resource = c.dynamicClient.Resource(mapping.Resource).Namespace(obj.Namespace)
+		}
+
+		if live, err := resource.Get(ctx, obj.Name, metav1.GetOptions{}); err == nil {
+			obj.UID = live.GetUID()
+		}
+	}
+}
+
+// poll 收集一次事件并保存
+func (c *eventCollector) poll(ctx context.Context) error {
+	related := make(map[types.UID]struct{})
+	names := make(map[string]struct{})
+	namespaces := make(map[string]struct{})
+	for _, obj := range c.objects {
+		if obj.UID != "" {
+			related[obj.UID] = struct{}{}
+		}
+		names[objectKey(obj.Kind, obj.Namespace, obj.Name)] = struct{}{}
+		if obj.Namespace != "" {
+			namespaces[obj.Namespace] = struct{}{}
+		} else {
+			namespaces[clusterEventNamespace] = struct{}{}
+		}
+	}
+
+	for namespace := range namespaces {
+		if err := c.addDescendants(ctx, namespace, related); err != nil {
+			return err
+		}
+
+		events, err := c.clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("获取命名空间 %s 的事件失败: %v", namespace, err)
+		}
+
+		for i := range events.Items {
+			event := &events.Items[i]
+			involved := event.InvolvedObject
+			_, byUID := related[involved.UID]
+			_, byName := names[objectKey(involved.Kind, involved.Namespace, involved.Name)]
+			if !byUID && !byName {
+				continue
+			}
+			// 同名资源在以前的交付中产生的事件
+			if k8s.EventLastSeen(event).Before(c.since) {
+				continue
+			}
+			if err := c.save(event); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addDescendants 将命名空间中属于已应用资源的ReplicaSet、Job和Pod加入related
+// 例如镜像拉取失败的事件记录在Deployment下属的Pod上
+func (c *eventCollector) addDescendants(ctx context.Context, namespace string, related map[types.UID]struct{}) error {
+	owners := make(map[types.UID][]types.UID)
+
+	replicaSets, err := c.clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("获取命名空间 %s 的ReplicaSet失败: %v", namespace, err)
+	}
+	for _, rs := range replicaSets.Items {
+		owners[rs.UID] = ownerUIDs(rs.OwnerReferences)
+	}
+
+	jobs, err := c.clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("获取命名空间 %s 的Job失败: %v", namespace, err)
+	}
+	for _, job := range jobs.Items {
+		owners[job.UID] = ownerUIDs(job.OwnerReferences)
+	}
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("获取命名空间 %s 的Pod失败: %v", namespace, err)
+	}
+	for _, pod := range pods.Items {
+		owners[pod.UID] = ownerUIDs(pod.OwnerReferences)
+	}
+
+	// 沿ownerReferences向下传播，直到没有新的资源加入
+	for changed := true; changed; {
+		changed = false
+		for uid, ownerList := range owners {
+			if _, ok := related[uid]; ok {
+				continue
+			}
+			for _, owner := range ownerList {
+				if _, ok := related[owner]; ok {
+					related[uid] = struct{}{}
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// save 合并并保存事件
+func (c *eventCollector) save(event *corev1.Event) error {
+	involved := event.InvolvedObject
+	sum := sha256.Sum256([]byte(objectKey(involved.Kind, involved.Namespace, involved.Name) +
+		"\x00" + event.Type + "\x00" + event.Reason + "\x00" + event.Message))
+	key := hex.EncodeToString(sum[:])
+
+	count := event.Count
+	if count == 0 {
+		count = 1
+	}
+	if event.Series != nil && event.Series.Count > count {
+		count = event.Series.Count
+	}
+	if c.seen[key] == nil {
+		c.seen[key] = make(map[types.UID]int32)
+	}
+	c.seen[key][event.UID] = count
+
+	var total int32
+	for _, n := range c.seen[key] {
+		total += n
+	}
+
+	firstSeen := event.FirstTimestamp.Time
+	if firstSeen.IsZero() {
+		firstSeen = event.CreationTimestamp.Time
+	}
+	// 重复发生的事件可能早于任务开始，只记录任务开始之后的部分
+	if firstSeen.Before(c.since) {
+		firstSeen = c.since
+	}
+	record := &TaskEvent{
+		TaskID:    c.task.ID,
+		Key:       key,
+		Namespace: involved.Namespace,
+		Kind:      involved.Kind,
+		Name:      involved.Name,
+		Type:      event.Type,
+		Reason:    event.Reason,
+		Message:   event.Message,
+		Count:     total,
+		FirstSeen: firstSeen,
+		LastSeen:  k8s.EventLastSeen(event),
+	}
+
+	// 首次发生时间取最早值，最后发生时间取最新值
+	err := c.manager.storageFactory.GetDB().Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "task_id"}, {Name: "key"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "count"}, Value: total},
+			{Column: clause.Column{Name: "first_seen"}, Value: clause.Expr{SQL: "MIN(first_seen, ?)", Vars: []interface{}{record.FirstSeen}}},
+			{Column: clause.Column{Name: "last_seen"}, Value: clause.Expr{SQL: "MAX(last_seen, ?)", Vars: []interface{}{record.LastSeen}}},
+		},
+	}).Create(record).Error
+	if err != nil {
+		return fmt.Errorf("保存事件失败: %v", err)
+	}
+	return nil
+}
+
+// objectKey 返回资源的kind/namespace/name形式
+func objectKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// ownerUIDs 返回ownerReferences中的UID
+func ownerUIDs(refs []metav1.OwnerReference) []types.UID {
+	uids := make([]types.UID, 0, len(refs))
+	for _, ref := range refs {
+		uids = append(uids, ref.UID)
+	}
+	return uids
+}
@@ -1,30 +1,55 @@
 package helm
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"github.com/huyouba1/kde/pkg/delivery"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// 确保Manager实现了delivery.Executor和delivery.Renderer
+var (
+	_ delivery.Executor = (*Manager)(nil)
+	_ delivery.Renderer = (*Manager)(nil)
 )
 
 // Manager Helm交付管理器
 type Manager struct {
-	workdir   string
-	cachePath string
+	workdir     string
+	cachePath   string
+	credentials *delivery.CredentialProvider
 }
 
 // NewManager 创建一个新的Helm交付管理器
-func NewManager(workdir, cachePath string) *Manager {
+func NewManager(workdir, cachePath string, credentials *delivery.CredentialProvider) *Manager {
 	return &Manager{
-		workdir:   workdir,
-		cachePath: cachePath,
+		workdir:     workdir,
+		cachePath:   cachePath,
+		credentials: credentials,
+	}
+}
+
+// Type 返回执行器处理的交付类型，实现delivery.Executor
+func (m *Manager) Type() delivery.DeliveryType {
+	return delivery.TypeHelm
+}
+
+// Execute 执行Helm交付任务，实现delivery.Executor
+func (m *Manager) Execute(ctx context.Context, task *delivery.DeliveryTask) error {
+	var options delivery.HelmOptions
+	if err := delivery.DecodeOptions(task, &options); err != nil {
+		return err
 	}
+	return m.Deploy(ctx, &options)
 }
 
 // Deploy 部署Helm Chart
@@ -35,17 +60,19 @@ func (m *Manager) Deploy(ctx context.Context, options *delivery.HelmOptions) err
 		return fmt.Errorf("创建工作目录失败: %v", err)
 	}
 
-	// 获取Kubernetes客户端配置
-	kubeconfig, err := m.getKubeconfigPath(options.ClusterID)
-	if err != nil {
-		return fmt.Errorf("获取kubeconfig失败: %v", err)
-	}
+	// 使用临时kubeconfig连接目标集群，执行结束后删除
+	return m.credentials.WithKubeconfigFile(options.ClusterID, func(kubeconfig string) error {
+		return m.deploy(ctx, deployDir, kubeconfig, options)
+	})
+}
 
+// deploy 使用指定的kubeconfig安装或升级Release
+func (m *Manager) deploy(ctx context.Context, deployDir, kubeconfig string, options *delivery.HelmOptions) error {
 	// 准备Helm命令参数
 	args := []string{}
 
 	// 检查是否已安装
-	installed, err := m.isReleaseInstalled(kubeconfig, options.Name, options.Namespace)
+	installed, err := m.isReleaseInstalled(ctx, kubeconfig, options.Name, options.Namespace)
 	if err != nil {
 		return fmt.Errorf("检查Release状态失败: %v", err)
 	}
@@ -58,8 +85,33 @@ func (m *Manager) Deploy(ctx context.Context, options *delivery.HelmOptions) err
 		args = append(args, "install")
 	}
 
-	// 添加Release名称
+	// 添加Release名称、Chart来源和值覆盖
+	chartArgs, err := m.chartArgs(ctx, deployDir, options)
+	if err != nil {
+		return err
+	}
 	args = append(args, options.Name)
+	args = append(args, chartArgs...)
+	if options.Namespace != "" {
+		args = append(args, "--create-namespace")
+	}
+
+	// 设置kubeconfig
+	args = append(args, "--kubeconfig", kubeconfig)
+
+	// 执行Helm命令
+	if err := m.runHelm(ctx, deployDir, args); err != nil {
+		return err
+	}
+
+	// 记录Release包含的资源，用于收集事件
+	m.recordManifest(ctx, kubeconfig, options.Name, options.Namespace)
+	return nil
+}
+
+// chartArgs 返回Chart来源、命名空间和值覆盖的命令参数，安装和渲染共用
+func (m *Manager) chartArgs(ctx context.Context, deployDir string, options *delivery.HelmOptions) ([]string, error) {
+	args := []string{}
 
 	// 添加Chart来源
 	if options.ChartPath != "" {
@@ -71,23 +123,22 @@ func (m *Manager) Deploy(ctx context.Context, options *delivery.HelmOptions) err
 		if options.ChartRepo != "" {
 			// 添加仓库
 			repoName := strings.Split(options.ChartRepo, "/")[0]
-			if err := m.addHelmRepo(repoName, options.ChartRepo); err != nil {
-				return fmt.Errorf("添加Helm仓库失败: %v", err)
+			if err := m.addHelmRepo(ctx, repoName, options.ChartRepo); err != nil {
+				return nil, fmt.Errorf("添加Helm仓库失败: %v", err)
 			}
 			chartRef = fmt.Sprintf("%s/%s", repoName, options.ChartName)
 		}
+		args = append(args, chartRef)
 
 		// 添加版本信息
 		if options.Version != "" {
-			chartRef = fmt.Sprintf("%s --version %s", chartRef, options.Version)
+			args = append(args, "--version", options.Version)
 		}
-
-		args = append(args, chartRef)
 	}
 
 	// 添加命名空间
 	if options.Namespace != "" {
-		args = append(args, "--namespace", options.Namespace, "--create-namespace")
+		args = append(args, "--namespace", options.Namespace)
 	}
 
 	// 添加值覆盖
@@ -95,53 +146,118 @@ func (m *Manager) Deploy(ctx context.Context, options *delivery.HelmOptions) err
 		// 创建values文件
 		valuesFile := filepath.Join(deployDir, "values.yaml")
 		if err := m.createValuesFile(valuesFile, options.Values); err != nil {
-			return fmt.Errorf("创建values文件失败: %v", err)
+			return nil, fmt.Errorf("创建values文件失败: %v", err)
 		}
 		args = append(args, "-f", valuesFile)
 	}
 
-	// 设置kubeconfig
-	args = append(args, "--kubeconfig", kubeconfig)
+	return args, nil
+}
 
-	// 执行Helm命令
+// Render 使用helm template渲染Chart，实现delivery.Renderer
+func (m *Manager) Render(ctx context.Context, task *delivery.DeliveryTask) (*delivery.ManifestReader, error) {
+	var options delivery.HelmOptions
+	if err := delivery.DecodeOptions(task, &options); err != nil {
+		return nil, err
+	}
+
+	renderDir := filepath.Join(m.workdir, options.ClusterID, "helm", options.Name, "preview-"+task.ID)
+	if err := os.MkdirAll(renderDir, 0755); err != nil {
+		return nil, fmt.Errorf("创建工作目录失败: %v", err)
+	}
+	defer os.RemoveAll(renderDir)
+
+	chartArgs, err := m.chartArgs(ctx, renderDir, &options)
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{"template", options.Name}, chartArgs...)
+
+	var stdout, stderr bytes.Buffer
 	cmd := exec.CommandContext(ctx, "helm", args...)
-	cmd.Dir = deployDir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("渲染Helm Chart失败: %v, 输出: %s", err, stderr.String())
+	}
 
-	// 捕获输出
-	output, err := cmd.CombinedOutput()
+	return delivery.NewManifestReader(&stdout, "helm template"), nil
+}
+
+// recordManifest 读取Release的资源清单并记录其中的资源，失败时只记录警告
+func (m *Manager) recordManifest(ctx context.Context, kubeconfig, name, namespace string) {
+	logger := delivery.LoggerFromContext(ctx)
+
+	args := []string{"get", "manifest", name}
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	args = append(args, "--kubeconfig", kubeconfig)
+
+	output, err := exec.CommandContext(ctx, "helm", args...).Output()
 	if err != nil {
-		return fmt.Errorf("执行Helm命令失败: %v, 输出: %s", err, string(output))
+		logger.Infof(delivery.LogSourceHelm, "读取Release资源清单失败: %v", err)
+		return
 	}
 
-	return nil
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(output), 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if !errors.Is(err, io.EOF) {
+				logger.Infof(delivery.LogSourceHelm, "解析Release资源清单失败: %v", err)
+			}
+			return
+		}
+		if obj.Object == nil || obj.GetKind() == "" {
+			continue
+		}
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(namespace)
+		}
+		delivery.RecordApplied(ctx, obj)
+	}
 }
 
 // Uninstall 卸载Helm Release
 func (m *Manager) Uninstall(ctx context.Context, clusterID, name, namespace string) error {
-	// 获取Kubernetes客户端配置
-	kubeconfig, err := m.getKubeconfigPath(clusterID)
-	if err != nil {
-		return fmt.Errorf("获取kubeconfig失败: %v", err)
-	}
+	return m.credentials.WithKubeconfigFile(clusterID, func(kubeconfig string) error {
+		// 准备Helm命令参数
+		args := []string{"uninstall", name}
 
-	// 准备Helm命令参数
-	args := []string{"uninstall", name}
+		// 添加命名空间
+		if namespace != "" {
+			args = append(args, "--namespace", namespace)
+		}
 
-	// 添加命名空间
-	if namespace != "" {
-		args = append(args, "--namespace", namespace)
-	}
+		// 设置kubeconfig
+		args = append(args, "--kubeconfig", kubeconfig)
 
-	// 设置kubeconfig
-	args = append(args, "--kubeconfig", kubeconfig)
+		// 执行Helm命令
+		return m.runHelm(ctx, "", args)
+	})
+}
+
+// runHelm 执行Helm命令，并将标准输出和标准错误逐行写入任务日志
+func (m *Manager) runHelm(ctx context.Context, dir string, args []string) error {
+	logger := delivery.LoggerFromContext(ctx)
+	logger.Infof(delivery.LogSourceHelm, "执行命令: helm %s", strings.Join(args, " "))
 
-	// 执行Helm命令
 	cmd := exec.CommandContext(ctx, "helm", args...)
+	cmd.Dir = dir
 
 	// 捕获输出
-	output, err := cmd.CombinedOutput()
+	var output bytes.Buffer
+	stdout := logger.Writer(delivery.LogSourceHelm, delivery.LogLevelInfo)
+	stderr := logger.Writer(delivery.LogSourceHelm, delivery.LogLevelError)
+	cmd.Stdout = io.MultiWriter(&output, stdout)
+	cmd.Stderr = io.MultiWriter(&output, stderr)
+
+	err := cmd.Run()
+	stdout.Close()
+	stderr.Close()
 	if err != nil {
-		return fmt.Errorf("执行Helm命令失败: %v, 输出: %s", err, string(output))
+		return fmt.Errorf("执行Helm命令失败: %v, 输出: %s", err, output.String())
 	}
 
 	return nil
@@ -149,37 +265,36 @@ func (m *Manager) Uninstall(ctx context.Context, clusterID, name, namespace stri
 
 // GetReleaseStatus 获取Release状态
 func (m *Manager) GetReleaseStatus(ctx context.Context, clusterID, name, namespace string) (string, error) {
-	// 获取Kubernetes客户端配置
-	kubeconfig, err := m.getKubeconfigPath(clusterID)
-	if err != nil {
-		return "", fmt.Errorf("获取kubeconfig失败: %v", err)
-	}
-
-	// 准备Helm命令参数
-	args := []string{"status", name, "--output", "json"}
-
-	// 添加命名空间
-	if namespace != "" {
-		args = append(args, "--namespace", namespace)
-	}
+	var status string
+	err := m.credentials.WithKubeconfigFile(clusterID, func(kubeconfig string) error {
+		// 准备Helm命令参数
+		args := []string{"status", name, "--output", "json"}
+
+		// 添加命名空间
+		if namespace != "" {
+			args = append(args, "--namespace", namespace)
+		}
 
-	// 设置kubeconfig
-	args = append(args, "--kubeconfig", kubeconfig)
+		// 设置kubeconfig
+		args = append(args, "--kubeconfig", kubeconfig)
 
-	// 执行Helm命令
-	cmd := exec.CommandContext(ctx, "helm", args...)
+		// 执行Helm命令
+		cmd := exec.CommandContext(ctx, "helm", args...)
 
-	// 捕获输出
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("执行Helm命令失败: %v, 输出: %s", err, string(output))
-	}
+		// 捕获输出
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("执行Helm命令失败: %v, 输出: %s", err, string(output))
+		}
 
-	return string(output), nil
+		status = string(output)
+		return nil
+	})
+	return status, err
 }
 
 // isReleaseInstalled 检查Release是否已安装
-func (m *Manager) isReleaseInstalled(kubeconfig, name, namespace string) (bool, error) {
+func (m *Manager) isReleaseInstalled(ctx context.Context, kubeconfig, name, namespace string) (bool, error) {
 	// 准备Helm命令参数
 	args := []string{"list", "--filter", name, "--output", "json"}
 
@@ -192,7 +307,7 @@ func (m *Manager) isReleaseInstalled(kubeconfig, name, namespace string) (bool,
 	args = append(args, "--kubeconfig", kubeconfig)
 
 	// 执行Helm命令
-	cmd := exec.Command("helm", args...)
+	cmd := exec.CommandContext(ctx, "helm", args...)
 
 	// 捕获输出
 	output, err := cmd.CombinedOutput()
@@ -205,9 +320,9 @@ func (m *Manager) isReleaseInstalled(kubeconfig, name, namespace string) (bool,
 }
 
 // addHelmRepo 添加Helm仓库
-func (m *Manager) addHelmRepo(name, url string) error {
+func (m *Manager) addHelmRepo(ctx context.Context, name, url string) error {
 	// 执行Helm命令添加仓库
-	cmd := exec.Command("helm", "repo", "add", name, url)
+	cmd := exec.CommandContext(ctx, "helm", "repo", "add", name, url)
 
 	// 捕获输出
 	output, err := cmd.CombinedOutput()
@@ -216,7 +331,7 @@ func (m *Manager) addHelmRepo(name, url string) error {
 	}
 
 	// 更新仓库
-	cmd = exec.Command("helm", "repo", "update")
+	cmd = exec.CommandContext(ctx, "helm", "repo", "update")
 	output, err = cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("更新Helm仓库失败: %v, 输出: %s", err, string(output))
@@ -236,35 +351,3 @@ func (m *Manager) createValuesFile(filePath string, values map[string]string) er
 	// 写入文件
 	return os.WriteFile(filePath, []byte(content), 0644)
 }
-
-// getKubeconfigPath 获取kubeconfig路径
-func (m *Manager) getKubeconfigPath(clusterID string) (string, error) {
-	// TODO: 从存储中获取集群的kubeconfig并保存到临时文件
-	// 这里应该实现从数据库获取kubeconfig并写入临时文件的逻辑
-
-	// 临时返回默认kubeconfig路径
-	return filepath.Join(os.Getenv("HOME"), ".kube", "config"), nil
-}
-
-// getKubernetesClient 获取Kubernetes客户端
-func (m *Manager) getKubernetesClient(clusterID string) (*kubernetes.Clientset, error) {
-	// 获取kubeconfig路径
-	kubeconfig, err := m.getKubeconfigPath(clusterID)
-	if err != nil {
-		return nil, err
-	}
-
-	// 加载kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
-	if err != nil {
-		return nil, fmt.Errorf("加载kubeconfig失败: %v", err)
-	}
-
-	// 创建clientset
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("创建Kubernetes客户端失败: %v", err)
-	}
-
-	return clientset, nil
-}
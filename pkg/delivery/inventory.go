@@ -0,0 +1,349 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	applycorev1 "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// PruneAnnotation 值为disabled时，资源从清单中移除后不会被删除
+	PruneAnnotation = "kde.io/prune"
+	// PruneDisabled 禁止删除资源
+	PruneDisabled = "disabled"
+	// InventoryLabel 集群中清单ConfigMap的标签，值为应用名称
+	InventoryLabel = "kde.io/inventory"
+	// inventoryConfigMapPrefix 集群中清单ConfigMap的名称前缀
+	inventoryConfigMapPrefix = "kde-inventory-"
+)
+
+// PruneAction 清理资源的结果
+type PruneAction string
+
+const (
+	// PruneDeleted 已删除
+	PruneDeleted PruneAction = "deleted"
+	// PruneWouldDelete 预览模式下将被删除
+	PruneWouldDelete PruneAction = "would-delete"
+	// PruneSkipped 未删除，原因见Reason
+	PruneSkipped PruneAction = "skipped"
+)
+
+// InventoryObject 清单中的一个资源
+type InventoryObject struct {
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// key 资源的唯一标识，不包含版本，同一资源更换API版本后仍视为同一资源
+func (o InventoryObject) key() string {
+	return o.Group + "/" + o.Kind + "/" + o.Namespace + "/" + o.Name
+}
+
+// inventoryObjectFor 根据apiVersion和kind创建清单中的资源
+func inventoryObjectFor(apiVersion, kind, namespace, name string) InventoryObject {
+	gv, _ := schema.ParseGroupVersion(apiVersion)
+	return InventoryObject{
+		Group:     gv.Group,
+		Version:   gv.Version,
+		Kind:      kind,
+		Namespace: namespace,
+		Name:      name,
+	}
+}
+
+// Inventory 一个应用最近一次交付的资源清单
+// 应用由集群、命名空间和交付名称确定
+type Inventory struct {
+	ID        uint              `json:"id" gorm:"primaryKey"`
+	ClusterID string            `json:"cluster_id" gorm:"uniqueIndex:idx_inventory_app"`
+	Namespace string            `json:"namespace" gorm:"uniqueIndex:idx_inventory_app"`
+	Name      string            `json:"name" gorm:"uniqueIndex:idx_inventory_app"`
+	TaskID    string            `json:"task_id"`
+	Objects   []InventoryObject `json:"objects" gorm:"type:text;serializer:json"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// PruneResult 清理一个资源的结果
+type PruneResult struct {
+	InventoryObject
+	Action PruneAction `json:"action"`
+	Reason string      `json:"reason,omitempty"`
+}
+
+// PruneOptions 资源清单和清理选项，YAML和Kustomize部署共用
+type PruneOptions struct {
+	// Prune 删除上次交付包含、本次不再包含的资源
+	Prune bool `json:"prune" form:"prune"`
+	// PruneDryRun 只预览将被删除的资源
+	PruneDryRun bool `json:"prune_dry_run" form:"prune_dry_run"`
+	// InventoryConfigMap 在集群中同步保存一份资源清单
+	InventoryConfigMap bool `json:"inventory_configmap" form:"inventory_configmap"`
+}
+
+// tracksInventory 交付类型是否记录资源清单，Helm由Release自行管理资源
+func (t DeliveryType) tracksInventory() bool {
+	return t == TypeYAML || t == TypeKustomize
+}
+
+// GetInventory 获取应用的资源清单，不存在时返回nil
+func (m *Manager) GetInventory(ctx context.Context, clusterID, namespace, name string) (*Inventory, error) {
+	var inventory Inventory
+	err := m.storageFactory.GetDB().WithContext(ctx).
+		Where("cluster_id = ? AND namespace = ? AND name = ?", clusterID, namespace, name).
+		First(&inventory).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询资源清单失败: %v", err)
+	}
+	return &inventory, nil
+}
+
+// saveInventory 保存应用的资源清单
+func (m *Manager) saveInventory(ctx context.Context, inventory *Inventory) error {
+	inventory.UpdatedAt = time.Now()
+	err := m.storageFactory.GetDB().WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "cluster_id"}, {Name: "namespace"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"task_id", "objects", "updated_at"}),
+	}).Create(inventory).Error
+	if err != nil {
+		return fmt.Errorf("保存资源清单失败: %v", err)
+	}
+	return nil
+}
+
+// updateInventory 交付结束后更新应用的资源清单，按需清理不再包含的资源
+// 交付失败时只将已应用的资源并入清单，不做清理
+func (m *Manager) updateInventory(ctx context.Context, task *DeliveryTask, recorder *appliedRecorder, execErr error) error {
+	logger := LoggerFromContext(ctx)
+
+	var options PruneOptions
+	if err := DecodeOptions(task, &options); err != nil {
+		return err
+	}
+
+	previous, err := m.GetInventory(ctx, task.ClusterID, task.Namespace, task.Name)
+	if err != nil {
+		return err
+	}
+	var previousObjects []InventoryObject
+	if previous != nil {
+		previousObjects = previous.Objects
+	}
+
+	inventory := &Inventory{ClusterID: task.ClusterID, Namespace: task.Namespace, Name: task.Name, TaskID: task.ID}
+	desired, complete := recorder.desiredObjects()
+	if execErr != nil || !complete {
+		inventory.Objects = mergeInventory(previousObjects, recorder.appliedInventory())
+		return m.saveInventory(ctx, inventory)
+	}
+	inventory.Objects = desired
+
+	if options.Prune {
+		orphans := inventoryDiff(previousObjects, desired)
+		results, err := m.prune(ctx, task.ClusterID, orphans, options.PruneDryRun)
+		RecordPrune(ctx, results...)
+		if err != nil {
+			// 未删除的资源保留在清单中，下次交付时重试
+			inventory.Objects = mergeInventory(inventory.Objects, orphans)
+			if saveErr := m.saveInventory(ctx, inventory); saveErr != nil {
+				logger.Errorf(LogSourcePrune, "%v", saveErr)
+			}
+			return err
+		}
+		for _, result := range results {
+			if result.Action == PruneWouldDelete {
+				inventory.Objects = append(inventory.Objects, result.InventoryObject)
+			}
+		}
+	}
+
+	if err := m.saveInventory(ctx, inventory); err != nil {
+		return err
+	}
+	if options.InventoryConfigMap {
+		if err := m.mirrorInventory(ctx, inventory); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prune 按与应用相反的顺序删除资源，dryRun为true时只返回将被删除的资源
+func (m *Manager) prune(ctx context.Context, clusterID string, objects []InventoryObject, dryRun bool) ([]*PruneResult, error) {
+	logger := LoggerFromContext(ctx)
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	clientset, dynamicClient, _, err := m.credentials.Clients(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	mapper := newResourceMapper(clientset.Discovery())
+
+	// 先删除工作负载，最后删除命名空间和CRD
+	sort.SliceStable(objects, func(i, j int) bool {
+		a := schema.GroupKind{Group: objects[i].Group, Kind: objects[i].Kind}
+		b := schema.GroupKind{Group: objects[j].Group, Kind: objects[j].Kind}
+		return kindPriority(a) > kindPriority(b)
+	})
+
+	results := make([]*PruneResult, 0, len(objects))
+	for _, object := range objects {
+		result := &PruneResult{InventoryObject: object}
+		results = append(results, result)
+
+		if err := pruneObject(ctx, dynamicClient, mapper, result, dryRun); err != nil {
+			result.Action, result.Reason = PruneSkipped, err.Error()
+			logger.Errorf(LogSourcePrune, "删除资源 %s %s 失败: %v", object.Kind, inventoryRef(object), err)
+			return results, fmt.Errorf("删除资源 %s %s 失败: %v", object.Kind, inventoryRef(object), err)
+		}
+
+		switch result.Action {
+		case PruneDeleted:
+			logger.Infof(LogSourcePrune, "已删除资源 %s %s", object.Kind, inventoryRef(object))
+		case PruneWouldDelete:
+			logger.Infof(LogSourcePrune, "预览: 将删除资源 %s %s", object.Kind, inventoryRef(object))
+		default:
+			logger.Infof(LogSourcePrune, "跳过资源 %s %s: %s", object.Kind, inventoryRef(object), result.Reason)
+		}
+	}
+	return results, nil
+}
+
+// pruneObject 删除单个资源，并将结果写入result
+func pruneObject(ctx context.Context, dynamicClient dynamic.Interface, mapper *resourceMapper, result *PruneResult, dryRun bool) error {
+	object := result.InventoryObject
+	gvk := schema.GroupVersionKind{Group: object.Group, Version: object.Version, Kind: object.Kind}
+
+	mapping, err := mapper.RESTMapping(gvk)
+	if meta.IsNoMatchError(err) {
+		result.Action, result.Reason = PruneSkipped, "资源类型已不存在"
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var resourceClient dynamic.ResourceInterface = dynamicClient.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		resourceClient = dynamicClient.Resource(mapping.Resource).Namespace(object.Namespace)
+	}
+
+	live, err := resourceClient.Get(ctx, object.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		result.Action, result.Reason = PruneSkipped, "资源已不存在"
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if live.GetAnnotations()[PruneAnnotation] == PruneDisabled {
+		result.Action, result.Reason = PruneSkipped, fmt.Sprintf("资源设置了 %s: %s", PruneAnnotation, PruneDisabled)
+		return nil
+	}
+	if live.GetDeletionTimestamp() != nil {
+		result.Action, result.Reason = PruneSkipped, "资源正在删除"
+		return nil
+	}
+
+	if dryRun {
+		result.Action = PruneWouldDelete
+		return nil
+	}
+
+	propagation := metav1.DeletePropagationBackground
+	uid := live.GetUID()
+	err = resourceClient.Delete(ctx, object.Name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+		// 只删除检查过注解的那个资源，避免误删同名的新资源
+		Preconditions: &metav1.Preconditions{UID: &uid},
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	result.Action = PruneDeleted
+	return nil
+}
+
+// mirrorInventory 将资源清单写入集群中的ConfigMap
+func (m *Manager) mirrorInventory(ctx context.Context, inventory *Inventory) error {
+	clientset, _, _, err := m.credentials.Clients(inventory.ClusterID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(inventory.Objects)
+	if err != nil {
+		return fmt.Errorf("序列化资源清单失败: %v", err)
+	}
+
+	namespace := inventory.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	configMap := applycorev1.ConfigMap(inventoryConfigMapPrefix+inventory.Name, namespace).
+		WithLabels(map[string]string{InventoryLabel: inventory.Name}).
+		WithData(map[string]string{
+			"task":    inventory.TaskID,
+			"objects": string(data),
+		})
+
+	_, err = clientset.CoreV1().ConfigMaps(namespace).Apply(ctx, configMap, metav1.ApplyOptions{
+		FieldManager: FieldManager,
+		Force:        true,
+	})
+	if err != nil {
+		return fmt.Errorf("保存资源清单ConfigMap失败: %v", err)
+	}
+	LoggerFromContext(ctx).Infof(LogSourcePrune, "资源清单已同步到ConfigMap %s/%s", namespace, *configMap.Name)
+	return nil
+}
+
+// inventoryDiff 返回previous中有、current中没有的资源
+func inventoryDiff(previous, current []InventoryObject) []InventoryObject {
+	keys := make(map[string]struct{}, len(current))
+	for _, object := range current {
+		keys[object.key()] = struct{}{}
+	}
+
+	var diff []InventoryObject
+	for _, object := range previous {
+		if _, ok := keys[object.key()]; !ok {
+			diff = append(diff, object)
+		}
+	}
+	return diff
+}
+
+// mergeInventory 合并两个清单，重复的资源以后者为准
+func mergeInventory(base, extra []InventoryObject) []InventoryObject {
+	merged := append([]InventoryObject(nil), inventoryDiff(base, extra)...)
+	return append(merged, extra...)
+}
+
+// inventoryRef 返回资源的namespace/name形式
+func inventoryRef(object InventoryObject) string {
+	if object.Namespace == "" {
+		return object.Name
+	}
+	return object.Namespace + "/" + object.Name
+}
@@ -0,0 +1,98 @@
+package delivery
+
+import (
+	"reflect"
+	"testing"
+)
+
+var (
+	inventoryDeployment   = InventoryObject{Group: "apps", Version: "v1", Kind: "Deployment", Namespace: "default", Name: "app"}
+	inventoryDeploymentV2 = InventoryObject{Group: "apps", Version: "v2", Kind: "Deployment", Namespace: "default", Name: "app"}
+	inventoryService      = InventoryObject{Version: "v1", Kind: "Service", Namespace: "default", Name: "app"}
+	inventoryOtherService = InventoryObject{Version: "v1", Kind: "Service", Namespace: "other", Name: "app"}
+	inventoryClusterRole  = InventoryObject{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole", Name: "app"}
+)
+
+func TestInventoryDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous []InventoryObject
+		current  []InventoryObject
+		want     []InventoryObject
+	}{
+		{
+			name:     "removed objects",
+			previous: []InventoryObject{inventoryDeployment, inventoryService, inventoryClusterRole},
+			current:  []InventoryObject{inventoryService},
+			want:     []InventoryObject{inventoryDeployment, inventoryClusterRole},
+		},
+		{
+			name:     "api version change is the same object",
+			previous: []InventoryObject{inventoryDeployment},
+			current:  []InventoryObject{inventoryDeploymentV2},
+		},
+		{
+			name:     "namespace is part of the identity",
+			previous: []InventoryObject{inventoryService},
+			current:  []InventoryObject{inventoryOtherService},
+			want:     []InventoryObject{inventoryService},
+		},
+		{
+			name:    "no previous inventory",
+			current: []InventoryObject{inventoryService},
+		},
+		{
+			name:     "empty current inventory",
+			previous: []InventoryObject{inventoryService},
+			want:     []InventoryObject{inventoryService},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inventoryDiff(tt.previous, tt.current); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inventoryDiff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeInventory(t *testing.T) {
+	tests := []struct {
+		name  string
+		base  []InventoryObject
+		extra []InventoryObject
+		want  []InventoryObject
+	}{
+		{
+			name:  "disjoint",
+			base:  []InventoryObject{inventoryDeployment},
+			extra: []InventoryObject{inventoryService},
+			want:  []InventoryObject{inventoryDeployment, inventoryService},
+		},
+		{
+			name:  "duplicates use extra",
+			base:  []InventoryObject{inventoryDeployment, inventoryClusterRole},
+			extra: []InventoryObject{inventoryDeploymentV2},
+			want:  []InventoryObject{inventoryClusterRole, inventoryDeploymentV2},
+		},
+		{
+			name:  "empty base",
+			extra: []InventoryObject{inventoryService},
+			want:  []InventoryObject{inventoryService},
+		},
+		{
+			name: "empty extra",
+			base: []InventoryObject{inventoryService},
+			want: []InventoryObject{inventoryService},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeInventory(tt.base, tt.extra); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeInventory() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
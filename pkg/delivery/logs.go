@@ -0,0 +1,316 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel 日志级别
+type LogLevel string
+
+const (
+	// LogLevelInfo 普通日志
+	LogLevelInfo LogLevel = "info"
+	// LogLevelError 错误日志
+	LogLevelError LogLevel = "error"
+)
+
+// LogSource 日志来源
+type LogSource string
+
+const (
+	// LogSourceTask 任务调度
+	LogSourceTask LogSource = "task"
+	// LogSourceApply 资源应用
+	LogSourceApply LogSource = "apply"
+	// LogSourceHelm Helm命令输出
+	LogSourceHelm LogSource = "helm"
+	// LogSourceWait 等待资源就绪
+	LogSourceWait LogSource = "wait"
+	// LogSourcePrune 资源清单和清理
+	LogSourcePrune LogSource = "prune"
+)
+
+// subscriberBuffer 每个订阅者缓存的日志条数，消费过慢的订阅者会被断开
+const subscriberBuffer = 256
+
+// TaskLog 交付任务日志
+type TaskLog struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	TaskID    string    `json:"task_id" gorm:"index"`
+	Level     LogLevel  `json:"level"`
+	Source    LogSource `json:"source"`
+	Message   string    `json:"message" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TaskLogger 写入单个交付任务的日志，nil值可以安全使用
+type TaskLogger struct {
+	manager *Manager
+	taskID  string
+}
+
+// taskLoggerContextKey 任务日志在上下文中的键
+type taskLoggerContextKey struct{}
+
+// WithLogger 将任务日志附加到上下文，供各交付后端写入日志
+func WithLogger(ctx context.Context, logger *TaskLogger) context.Context {
+	return context.WithValue(ctx, taskLoggerContextKey{}, logger)
+}
+
+// LoggerFromContext 获取上下文中的任务日志，不存在时返回nil
+func LoggerFromContext(ctx context.Context) *TaskLogger {
+	logger, _ := ctx.Value(taskLoggerContextKey{}).(*TaskLogger)
+	return logger
+}
+
+// Infof 写入一条普通日志
+func (l *TaskLogger) Infof(source LogSource, format string, args ...interface{}) {
+	l.write(LogLevelInfo, source, fmt.Sprintf(format, args...))
+}
+
+// Errorf 写入一条错误日志
+func (l *TaskLogger) Errorf(source LogSource, format string, args ...interface{}) {
+	l.write(LogLevelError, source, fmt.Sprintf(format, args...))
+}
+
+// Writer 返回按行写入日志的Writer，用于转发命令的标准输出和标准错误
+func (l *TaskLogger) Writer(source LogSource, level LogLevel) *LineWriter {
+	return &LineWriter{logger: l, source: source, level: level}
+}
+
+// write 保存日志并推送给订阅者
+func (l *TaskLogger) write(level LogLevel, source LogSource, message string) {
+	if l == nil {
+		return
+	}
+
+	entry := &TaskLog{
+		TaskID:    l.taskID,
+		Level:     level,
+		Source:    source,
+		Message:   message,
+		CreatedAt: time.Now(),
+	}
+	if err := l.manager.storageFactory.GetDB().Create(entry).Error; err != nil {
+		fmt.Printf("任务 %s: 保存日志失败: %v\n", l.taskID, err)
+		return
+	}
+	l.manager.logs.publish(entry)
+}
+
+// LineWriter 将写入的内容按行拆分为任务日志
+type LineWriter struct {
+	logger *TaskLogger
+	source LogSource
+	level  LogLevel
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write 实现io.Writer
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			// 不完整的行放回缓冲区，等待后续写入
+			w.buf.Reset()
+			w.buf.WriteString(line)
+			break
+		}
+		w.logger.write(w.level, w.source, strings.TrimRight(line, "\r\n"))
+	}
+	return len(p), nil
+}
+
+// Close 写入缓冲区中剩余的内容
+func (w *LineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.buf.Len() > 0 {
+		w.logger.write(w.level, w.source, w.buf.String())
+		w.buf.Reset()
+	}
+	return nil
+}
+
+// logHub 任务日志的实时订阅
+type logHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan *TaskLog]struct{}
+}
+
+// newLogHub 创建日志订阅中心
+func newLogHub() *logHub {
+	return &logHub{
+		subscribers: make(map[string]map[chan *TaskLog]struct{}),
+	}
+}
+
+// subscribe 订阅任务日志，返回的通道在任务结束或订阅者消费过慢时关闭
+func (h *logHub) subscribe(taskID string) (<-chan *TaskLog, func()) {
+	ch := make(chan *TaskLog, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[taskID] == nil {
+		h.subscribers[taskID] = make(map[chan *TaskLog]struct{})
+	}
+	h.subscribers[taskID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(taskID, ch)
+	}
+}
+
+// publish 推送日志给订阅者
+func (h *logHub) publish(entry *TaskLog) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[entry.TaskID] {
+		select {
+		case ch <- entry:
+		default:
+			// 订阅者消费过慢，断开后由订阅者从数据库补齐
+			h.remove(entry.TaskID, ch)
+		}
+	}
+}
+
+// finish 任务结束，关闭所有订阅
+func (h *logHub) finish(taskID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[taskID] {
+		h.remove(taskID, ch)
+	}
+}
+
+// remove 移除并关闭订阅通道，调用方需持有锁
+func (h *logHub) remove(taskID string, ch chan *TaskLog) {
+	subs, ok := h.subscribers[taskID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[ch]; !ok {
+		return
+	}
+
+	delete(subs, ch)
+	close(ch)
+	if len(subs) == 0 {
+		delete(h.subscribers, taskID)
+	}
+}
+
+// taskLogger 创建任务日志
+func (m *Manager) taskLogger(taskID string) *TaskLogger {
+	return &TaskLogger{manager: m, taskID: taskID}
+}
+
+// ListTaskLogs 获取任务中ID大于afterID的日志
+func (m *Manager) ListTaskLogs(ctx context.Context, taskID string, afterID uint) ([]*TaskLog, error) {
+	logs := make([]*TaskLog, 0)
+	err := m.storageFactory.GetDB().WithContext(ctx).
+		Where("task_id = ? AND id > ?", taskID, afterID).
+		Order("id ASC").
+		Find(&logs).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询任务日志失败: %v", err)
+	}
+	return logs, nil
+}
+
+// FollowTaskLogs 跟踪任务日志：先返回已保存的日志，再实时推送新日志，任务结束后关闭通道
+func (m *Manager) FollowTaskLogs(ctx context.Context, taskID string, afterID uint) (<-chan *TaskLog, error) {
+	if _, err := m.GetTask(ctx, taskID); err != nil {
+		return nil, err
+	}
+
+	out := make(chan *TaskLog)
+	go func() {
+		defer close(out)
+
+		for {
+			// 先订阅再读取历史日志，避免两者之间的日志丢失
+			live, unsubscribe := m.logs.subscribe(taskID)
+
+			done, err := m.sendBacklog(ctx, taskID, &afterID, out)
+			if err != nil || done {
+				unsubscribe()
+				return
+			}
+
+			if !m.forwardLogs(ctx, live, &afterID, out) {
+				unsubscribe()
+				return
+			}
+			// 订阅已关闭：任务结束或消费过慢，回到循环开头从数据库补齐
+			unsubscribe()
+		}
+	}()
+
+	return out, nil
+}
+
+// sendBacklog 发送数据库中的历史日志，任务已结束时返回true
+func (m *Manager) sendBacklog(ctx context.Context, taskID string, afterID *uint, out chan<- *TaskLog) (bool, error) {
+	// 先读取任务状态，确保任务结束前写入的日志都能在随后读取到
+	task, err := m.GetTask(ctx, taskID)
+	if err != nil {
+		return false, err
+	}
+
+	logs, err := m.ListTaskLogs(ctx, taskID, *afterID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range logs {
+		select {
+		case out <- entry:
+			*afterID = entry.ID
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+
+	return task.Status.Finished(), nil
+}
+
+// forwardLogs 转发实时日志直到订阅关闭，上下文取消时返回false
+func (m *Manager) forwardLogs(ctx context.Context, live <-chan *TaskLog, afterID *uint, out chan<- *TaskLog) bool {
+	for {
+		select {
+		case entry, ok := <-live:
+			if !ok {
+				return true
+			}
+			if entry.ID <= *afterID {
+				continue
+			}
+			select {
+			case out <- entry:
+				*afterID = entry.ID
+			case <-ctx.Done():
+				return false
+			}
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
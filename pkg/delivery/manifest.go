@@ -0,0 +1,266 @@
+package delivery
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// sourceMarker 标记后续文档所属文件的注释，ReadManifests合并交付包时写入，
+// 与helm template的输出格式一致
+const sourceMarker = "# Source: "
+
+// yamlErrorLine 匹配YAML解析错误中的行号
+var yamlErrorLine = regexp.MustCompile(`line (\d+)`)
+
+// Manifest 资源清单中的一个资源
+type Manifest struct {
+	Object *unstructured.Unstructured
+	// Source 资源所在的文件
+	Source string
+	// Line 资源在文件中的起始行
+	Line int
+}
+
+// Position 返回资源的file:line位置
+func (m *Manifest) Position() string {
+	return fmt.Sprintf("%s:%d", m.Source, m.Line)
+}
+
+// ManifestReader 流式读取多文档YAML/JSON资源清单
+// 按---分隔文档，跳过空文档和只有注释的文档，展开List类型中的资源
+type ManifestReader struct {
+	reader *bufio.Reader
+	// source 当前读取的文件，遇到sourceMarker时切换
+	source string
+	// line 当前文件已读取的行数
+	line int
+	// carry 分隔符后同一行的内容，属于下一个文档
+	carry   string
+	pending []*Manifest
+	eof     bool
+}
+
+// NewManifestReader 创建资源清单读取器，source为错误信息中使用的文件名
+func NewManifestReader(r io.Reader, source string) *ManifestReader {
+	return &ManifestReader{
+		reader: bufio.NewReader(r),
+		source: source,
+	}
+}
+
+// Next 返回下一个资源，读取完毕时返回io.EOF
+func (r *ManifestReader) Next() (*Manifest, error) {
+	for len(r.pending) == 0 {
+		doc, err := r.readDocument()
+		if err != nil {
+			return nil, err
+		}
+		if err := r.decode(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest := r.pending[0]
+	r.pending = r.pending[1:]
+	return manifest, nil
+}
+
+// ReadAll 读取所有资源
+func (r *ManifestReader) ReadAll() ([]*Manifest, error) {
+	var manifests []*Manifest
+	for {
+		manifest, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return manifests, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+}
+
+// document 一个YAML文档及其位置
+type document struct {
+	data   []byte
+	source string
+	// firstLine 文档第一行的行号
+	firstLine int
+	// startLine 文档中第一个非空、非注释行的行号
+	startLine int
+}
+
+// readDocument 读取下一个非空文档
+func (r *ManifestReader) readDocument() (*document, error) {
+	for {
+		doc := &document{source: r.source, firstLine: r.line + 1}
+		var buf bytes.Buffer
+		if r.carry != "" {
+			// 分隔符所在行的内容属于新文档
+			doc.firstLine, doc.startLine = r.line, r.line
+			buf.WriteString(r.carry + "\n")
+			r.carry = ""
+		}
+
+		for !r.eof {
+			line, err := r.reader.ReadString('\n')
+			if errors.Is(err, io.EOF) {
+				r.eof = true
+				if line == "" {
+					break
+				}
+			} else if err != nil {
+				return nil, fmt.Errorf("%s: 读取资源清单失败: %v", r.source, err)
+			}
+			r.line++
+
+			// 分隔符必须位于行首，块标量中缩进的---属于内容
+			if rest, ok := documentSeparator(strings.TrimRight(line, " \t\r\n")); ok {
+				r.carry = rest
+				break
+			}
+
+			trimmed := strings.TrimSpace(line)
+			// 文档开头的来源标记，之后的行号从该文件第一行开始计算
+			if doc.startLine == 0 && strings.HasPrefix(trimmed, sourceMarker) {
+				r.source = strings.TrimSpace(strings.TrimPrefix(trimmed, sourceMarker))
+				r.line = 0
+				buf.Reset()
+				doc = &document{source: r.source, firstLine: 1}
+				continue
+			}
+
+			if doc.startLine == 0 && trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+				doc.startLine = r.line
+			}
+			buf.WriteString(line)
+		}
+
+		// 跳过空文档和只有注释的文档
+		if doc.startLine != 0 {
+			doc.data = buf.Bytes()
+			return doc, nil
+		}
+		if r.eof && r.carry == "" {
+			return nil, io.EOF
+		}
+	}
+}
+
+// documentSeparator 判断一行是否为文档分隔符，返回分隔符后的内容
+func documentSeparator(line string) (string, bool) {
+	if line == "..." {
+		return "", true
+	}
+	if !strings.HasPrefix(line, "---") {
+		return "", false
+	}
+
+	rest := line[3:]
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return "", false
+	}
+	rest = strings.TrimSpace(rest)
+	if strings.HasPrefix(rest, "#") {
+		rest = ""
+	}
+	return rest, true
+}
+
+// decode 解析文档中的资源，文档为JSON时可以包含多个对象
+func (r *ManifestReader) decode(doc *document) error {
+	objects, err := decodeObjects(utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(doc.data), 4096))
+
+	// 以{开头的YAML流式映射会被识别为JSON，按YAML重新解析
+	var jsonErr utilyaml.JSONSyntaxError
+	if errors.As(err, &jsonErr) {
+		if yamlObjects, yamlErr := decodeObjects(utilyaml.NewYAMLToJSONDecoder(bytes.NewReader(doc.data))); yamlErr == nil {
+			objects, err = yamlObjects, nil
+		}
+	}
+	if err != nil {
+		return doc.error(err)
+	}
+
+	for _, obj := range objects {
+		if err := r.add(obj, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeObjects 解析解码器中的所有非空对象
+func decodeObjects(decoder interface{ Decode(into interface{}) error }) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	for {
+		obj := &unstructured.Unstructured{}
+		err := decoder.Decode(&obj.Object)
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(obj.Object) != 0 {
+			objects = append(objects, obj)
+		}
+	}
+}
+
+// add 校验资源并加入待返回的队列，List类型展开为其中的资源
+func (r *ManifestReader) add(obj *unstructured.Unstructured, doc *document) error {
+	position := fmt.Sprintf("%s:%d", doc.source, doc.startLine)
+	if obj.GetAPIVersion() == "" || obj.GetKind() == "" {
+		return fmt.Errorf("%s: 资源缺少apiVersion或kind", position)
+	}
+
+	if obj.IsList() {
+		list, err := obj.ToList()
+		if err != nil {
+			return fmt.Errorf("%s: 解析%s失败: %v", position, obj.GetKind(), err)
+		}
+		for i := range list.Items {
+			if err := r.add(&list.Items[i], doc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	r.pending = append(r.pending, &Manifest{
+		Object: obj,
+		Source: doc.source,
+		Line:   doc.startLine,
+	})
+	return nil
+}
+
+// error 将解析错误转换为带file:line位置的错误
+func (d *document) error(err error) error {
+	line := d.startLine
+
+	var jsonErr utilyaml.JSONSyntaxError
+	if errors.As(err, &jsonErr) {
+		offset := int(jsonErr.Offset)
+		if offset > len(d.data) {
+			offset = len(d.data)
+		}
+		line = d.firstLine + bytes.Count(d.data[:offset], []byte("\n"))
+	} else if match := yamlErrorLine.FindStringSubmatch(err.Error()); match != nil {
+		if n, convErr := strconv.Atoi(match[1]); convErr == nil {
+			line = d.firstLine + n - 1
+		}
+	}
+
+	return fmt.Errorf("%s:%d: 解析资源清单失败: %v", d.source, line, err)
+}
@@ -0,0 +1,114 @@
+package delivery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestManifestReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		// want 每个资源的kind/name@file:line
+		want []string
+	}{
+		{
+			name:  "single document",
+			input: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n",
+			want:  []string{"ConfigMap/a@test.yaml:1"},
+		},
+		{
+			name:  "crlf line endings",
+			input: "apiVersion: v1\r\nkind: ConfigMap\r\nmetadata:\r\n  name: a\r\n---\r\napiVersion: v1\r\nkind: Secret\r\nmetadata:\r\n  name: b\r\n",
+			want:  []string{"ConfigMap/a@test.yaml:1", "Secret/b@test.yaml:6"},
+		},
+		{
+			name:  "separator with comment",
+			input: "--- # first\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n---   #second\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: b\n",
+			want:  []string{"ConfigMap/a@test.yaml:2", "ConfigMap/b@test.yaml:7"},
+		},
+		{
+			name:  "empty and comment-only documents",
+			input: "---\n# only a comment\n---\n\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n...\n",
+			want:  []string{"ConfigMap/a@test.yaml:6"},
+		},
+		{
+			name:  "block scalar containing separator",
+			input: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\ndata:\n  doc: |\n    ---\n    key: value\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: b\n",
+			want:  []string{"ConfigMap/a@test.yaml:1", "ConfigMap/b@test.yaml:10"},
+		},
+		{
+			name:  "list expansion",
+			input: "apiVersion: v1\nkind: List\nitems:\n- apiVersion: v1\n  kind: ConfigMap\n  metadata:\n    name: a\n- apiVersion: v1\n  kind: Service\n  metadata:\n    name: b\n",
+			want:  []string{"ConfigMap/a@test.yaml:1", "Service/b@test.yaml:1"},
+		},
+		{
+			name:  "source markers",
+			input: "---\n# Source: base/a.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n---\n# Source: base/b.yaml\n\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: b\n",
+			want:  []string{"ConfigMap/a@base/a.yaml:1", "ConfigMap/b@base/b.yaml:2"},
+		},
+		{
+			name:  "json objects",
+			input: `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"}}` + "\n" + `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"b"}}`,
+			want:  []string{"ConfigMap/a@test.yaml:1", "ConfigMap/b@test.yaml:1"},
+		},
+		{
+			name:  "yaml flow mapping",
+			input: "{apiVersion: v1, kind: ConfigMap, metadata: {name: a}}\n",
+			want:  []string{"ConfigMap/a@test.yaml:1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifests, err := NewManifestReader(strings.NewReader(tt.input), "test.yaml").ReadAll()
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			got := make([]string, 0, len(manifests))
+			for _, manifest := range manifests {
+				got = append(got, manifest.Object.GetKind()+"/"+manifest.Object.GetName()+"@"+manifest.Position())
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ReadAll() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifestReaderErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		// want 错误信息的前缀
+		want string
+	}{
+		{
+			name:  "missing kind",
+			input: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n---\napiVersion: v1\nmetadata:\n  name: b\n",
+			want:  "test.yaml:6: ",
+		},
+		{
+			name:  "invalid yaml",
+			input: "apiVersion: v1\nkind: ConfigMap\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n    bad: b\n",
+			want:  "test.yaml:8: ",
+		},
+		{
+			name:  "invalid json",
+			input: "{\"apiVersion\": \"v1\",\n\"kind\": \"ConfigMap\",\n\"metadata\": {\"name\": \"a\"]}\n",
+			want:  "test.yaml:3: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewManifestReader(strings.NewReader(tt.input), "test.yaml").ReadAll()
+			if err == nil {
+				t.Fatal("ReadAll() error = nil")
+			}
+			if !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("ReadAll() error = %q, want prefix %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package delivery
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/restmapper"
+)
+
+// resourceMapper 基于服务端发现解析资源的GVR和作用域
+// 发现结果在一次交付内缓存；同一批资源中应用了CRD后，遇到未知类型时重新发现一次
+type resourceMapper struct {
+	mapper *restmapper.DeferredDiscoveryRESTMapper
+	// stale 应用CRD后尚未重新发现
+	stale bool
+}
+
+// newResourceMapper 创建资源映射器
+func newResourceMapper(client discovery.DiscoveryInterface) *resourceMapper {
+	return &resourceMapper{
+		mapper: restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(client)),
+	}
+}
+
+// RESTMapping 获取资源类型的映射
+func (r *resourceMapper) RESTMapping(gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	mapping, err := r.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) && r.stale {
+		r.stale = false
+		r.mapper.Reset()
+		mapping, err = r.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	return mapping, err
+}
+
+// CRDApplied 记录新的CRD已生效，之后的未知类型会触发一次重新发现
+func (r *resourceMapper) CRDApplied() {
+	r.stale = true
+}
+
+// isCRD 判断资源是否为CustomResourceDefinition
+func isCRD(gvk schema.GroupVersionKind) bool {
+	return gvk.Group == "apiextensions.k8s.io" && gvk.Kind == "CustomResourceDefinition"
+}
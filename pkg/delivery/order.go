@@ -0,0 +1,152 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// ApplyWaveAnnotation 指定资源的应用批次，批次小的先应用，未指定时为0
+const ApplyWaveAnnotation = "kde.io/apply-wave"
+
+const (
+	// crdEstablishTimeout 等待CRD生效的超时时间
+	crdEstablishTimeout = 60 * time.Second
+	// crdPollInterval 检查CRD状态的间隔
+	crdPollInterval = time.Second
+)
+
+// crdResource CustomResourceDefinition的GVR
+var crdResource = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// kindPriorities 同一批次内按类型排序，依赖方排在被依赖方之后
+// 未列出的类型（包括自定义资源）排在工作负载之后、Webhook之前
+var kindPriorities = map[schema.GroupKind]int{
+	{Kind: "Namespace"}: 0,
+
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}: 1,
+
+	{Kind: "ServiceAccount"}:                                         2,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:        2,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}: 2,
+	{Group: "rbac.authorization.k8s.io", Kind: "Role"}:               2,
+	{Group: "rbac.authorization.k8s.io", Kind: "RoleBinding"}:        2,
+
+	{Kind: "ResourceQuota"}:                             3,
+	{Kind: "LimitRange"}:                                3,
+	{Group: "scheduling.k8s.io", Kind: "PriorityClass"}: 3,
+	{Group: "storage.k8s.io", Kind: "StorageClass"}:     3,
+	{Kind: "ConfigMap"}:                                 3,
+	{Kind: "Secret"}:                                    3,
+	{Kind: "PersistentVolume"}:                          3,
+	{Kind: "PersistentVolumeClaim"}:                     3,
+
+	{Kind: "Service"}: 4,
+
+	{Kind: "Pod"}:                                           5,
+	{Kind: "ReplicationController"}:                         5,
+	{Group: "apps", Kind: "Deployment"}:                     5,
+	{Group: "apps", Kind: "StatefulSet"}:                    5,
+	{Group: "apps", Kind: "DaemonSet"}:                      5,
+	{Group: "apps", Kind: "ReplicaSet"}:                     5,
+	{Group: "batch", Kind: "Job"}:                           5,
+	{Group: "batch", Kind: "CronJob"}:                       5,
+	{Group: "autoscaling", Kind: "HorizontalPodAutoscaler"}: 5,
+	{Group: "policy", Kind: "PodDisruptionBudget"}:          5,
+	{Group: "networking.k8s.io", Kind: "Ingress"}:           5,
+	{Group: "networking.k8s.io", Kind: "NetworkPolicy"}:     5,
+
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"}:   7,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"}: 7,
+}
+
+// defaultKindPriority 未列出类型的优先级
+const defaultKindPriority = 6
+
+// kindPriority 返回资源类型的应用优先级
+func kindPriority(gk schema.GroupKind) int {
+	if priority, ok := kindPriorities[gk]; ok {
+		return priority
+	}
+	return defaultKindPriority
+}
+
+// applyWave 解析资源的应用批次
+func applyWave(manifest *Manifest) (int, error) {
+	value, ok := manifest.Object.GetAnnotations()[ApplyWaveAnnotation]
+	if !ok {
+		return 0, nil
+	}
+	wave, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: 无效的 %s 注解 %q，必须为整数", manifest.Position(), ApplyWaveAnnotation, value)
+	}
+	return wave, nil
+}
+
+// SortManifests 按应用批次和类型优先级排序资源，相同时保持清单中的顺序
+func SortManifests(manifests []*Manifest) error {
+	waves := make(map[*Manifest]int, len(manifests))
+	for _, manifest := range manifests {
+		wave, err := applyWave(manifest)
+		if err != nil {
+			return err
+		}
+		waves[manifest] = wave
+	}
+
+	sort.SliceStable(manifests, func(i, j int) bool {
+		a, b := manifests[i], manifests[j]
+		if waves[a] != waves[b] {
+			return waves[a] < waves[b]
+		}
+		return kindPriority(a.Object.GroupVersionKind().GroupKind()) < kindPriority(b.Object.GroupVersionKind().GroupKind())
+	})
+	return nil
+}
+
+// waitForCRDs 等待CRD的Established条件为True，之后才能创建对应的自定义资源
+func (a *Applier) waitForCRDs(ctx context.Context, names []string) error {
+	logger := LoggerFromContext(ctx)
+	logger.Infof(LogSourceApply, "等待 %d 个CRD就绪", len(names))
+
+	for _, name := range names {
+		var lastErr error
+		err := wait.PollUntilContextTimeout(ctx, crdPollInterval, crdEstablishTimeout, true, func(ctx context.Context) (bool, error) {
+			crd, err := a.dynamicClient.Resource(crdResource).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				lastErr = err
+				return false, nil
+			}
+			return crdEstablished(crd), nil
+		})
+		if err != nil {
+			if lastErr != nil {
+				return fmt.Errorf("等待CRD %s 就绪失败: %v", name, lastErr)
+			}
+			return fmt.Errorf("等待CRD %s 就绪超时", name)
+		}
+	}
+
+	// CRD生效后重新发现一次，使新的资源类型可以被解析
+	a.mapper.CRDApplied()
+	logger.Infof(LogSourceApply, "CRD已就绪")
+	return nil
+}
+
+// crdEstablished 判断CRD是否已生效
+func crdEstablished(crd *unstructured.Unstructured) bool {
+	condition := findCondition(crd, "Established")
+	return condition != nil && condition["status"] == "True"
+}
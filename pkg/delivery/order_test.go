@@ -0,0 +1,103 @@
+package delivery
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// testManifest 创建测试用的资源，wave为空时不设置应用批次注解
+func testManifest(apiVersion, kind, name, wave string) *Manifest {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetName(name)
+	if wave != "" {
+		obj.SetAnnotations(map[string]string{ApplyWaveAnnotation: wave})
+	}
+	return &Manifest{Object: obj, Source: "test.yaml", Line: 1}
+}
+
+func TestSortManifests(t *testing.T) {
+	tests := []struct {
+		name      string
+		manifests []*Manifest
+		want      []string
+	}{
+		{
+			name: "kind priority",
+			manifests: []*Manifest{
+				testManifest("admissionregistration.k8s.io/v1", "ValidatingWebhookConfiguration", "webhook", ""),
+				testManifest("example.com/v1", "Widget", "widget", ""),
+				testManifest("apps/v1", "Deployment", "app", ""),
+				testManifest("v1", "Service", "svc", ""),
+				testManifest("v1", "ConfigMap", "config", ""),
+				testManifest("rbac.authorization.k8s.io/v1", "Role", "role", ""),
+				testManifest("apiextensions.k8s.io/v1", "CustomResourceDefinition", "widgets.example.com", ""),
+				testManifest("v1", "Namespace", "ns", ""),
+			},
+			want: []string{"ns", "widgets.example.com", "role", "config", "svc", "app", "widget", "webhook"},
+		},
+		{
+			name: "stable within the same priority",
+			manifests: []*Manifest{
+				testManifest("v1", "Secret", "b", ""),
+				testManifest("v1", "ConfigMap", "a", ""),
+				testManifest("v1", "Secret", "c", ""),
+			},
+			want: []string{"b", "a", "c"},
+		},
+		{
+			name: "waves before kind priority",
+			manifests: []*Manifest{
+				testManifest("v1", "Namespace", "late", "1"),
+				testManifest("apps/v1", "Deployment", "app", ""),
+				testManifest("batch/v1", "Job", "migrate", "-1"),
+				testManifest("v1", "ConfigMap", "config", "0"),
+			},
+			want: []string{"migrate", "config", "app", "late"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SortManifests(tt.manifests); err != nil {
+				t.Fatalf("SortManifests() error = %v", err)
+			}
+			got := make([]string, 0, len(tt.manifests))
+			for _, manifest := range tt.manifests {
+				got = append(got, manifest.Object.GetName())
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("SortManifests() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyWave(t *testing.T) {
+	tests := []struct {
+		name    string
+		wave    string
+		want    int
+		wantErr bool
+	}{
+		{name: "not set", want: 0},
+		{name: "positive", wave: "3", want: 3},
+		{name: "negative", wave: "-2", want: -2},
+		{name: "not an integer", wave: "first", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyWave(testManifest("v1", "ConfigMap", "a", tt.wave))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyWave() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("applyWave() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
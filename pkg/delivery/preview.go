@@ -0,0 +1,292 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// Renderer 将交付任务渲染为资源清单，用于部署前预览，各交付后端可选实现
+type Renderer interface {
+	// Render 渲染任务的资源清单，不修改集群
+	Render(ctx context.Context, task *DeliveryTask) (*ManifestReader, error)
+}
+
+// PreviewAction 预览时资源将发生的变化
+type PreviewAction string
+
+const (
+	// PreviewCreate 资源不存在，将被创建
+	PreviewCreate PreviewAction = "create"
+	// PreviewUpdate 资源已存在，将被修改
+	PreviewUpdate PreviewAction = "update"
+	// PreviewUnchanged 资源已存在且不会变化
+	PreviewUnchanged PreviewAction = "unchanged"
+	// PreviewError 资源无法试运行，原因见Error
+	PreviewError PreviewAction = "error"
+)
+
+// secretMask 替换Secret数据的掩码
+const secretMask = "***"
+
+// lastAppliedAnnotation kubectl apply保存的上次应用的完整配置，Secret的该注解包含明文数据
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// ignoredPreviewFields 比较前移除的由服务端维护的字段
+var ignoredPreviewFields = [][]string{
+	{"metadata", "managedFields"},
+	{"metadata", "resourceVersion"},
+	{"metadata", "generation"},
+	{"metadata", "uid"},
+	{"metadata", "creationTimestamp"},
+	{"status"},
+}
+
+// ObjectDiff 单个资源的预览结果
+type ObjectDiff struct {
+	Kind      string        `json:"kind"`
+	Namespace string        `json:"namespace,omitempty"`
+	Name      string        `json:"name"`
+	Position  string        `json:"position,omitempty"`
+	Action    PreviewAction `json:"action"`
+	// Diff 集群中的当前状态与试运行结果之间的统一差异格式
+	Diff  string `json:"diff,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// PreviewYAML 预览YAML部署将对集群产生的变化
+func (m *Manager) PreviewYAML(ctx context.Context, options *YAMLOptions) ([]*ObjectDiff, error) {
+	task, err := newTask(TypeYAML, options.Name, options.ClusterID, options.ClusterName, options.Namespace, options)
+	if err != nil {
+		return nil, err
+	}
+	task.FilePath = options.FilePath
+	return m.preview(ctx, task, options.ConflictPolicy)
+}
+
+// PreviewHelm 预览Helm部署将对集群产生的变化
+func (m *Manager) PreviewHelm(ctx context.Context, options *HelmOptions) ([]*ObjectDiff, error) {
+	task, err := newTask(TypeHelm, options.Name, options.ClusterID, options.ClusterName, options.Namespace, options)
+	if err != nil {
+		return nil, err
+	}
+	return m.preview(ctx, task, ConflictForce)
+}
+
+// PreviewKustomize 预览Kustomize部署将对集群产生的变化，返回前删除上传的交付包
+func (m *Manager) PreviewKustomize(ctx context.Context, options *KustomizeOptions) ([]*ObjectDiff, error) {
+	defer m.RemoveBundle(options.BundleDir)
+
+	task, err := newTask(TypeKustomize, options.Name, options.ClusterID, options.ClusterName, options.Namespace, options)
+	if err != nil {
+		return nil, err
+	}
+	return m.preview(ctx, task, options.ConflictPolicy)
+}
+
+// preview 渲染任务的资源清单并在目标集群上试运行，任务不会被保存
+func (m *Manager) preview(ctx context.Context, task *DeliveryTask, policy ConflictPolicy) ([]*ObjectDiff, error) {
+	renderer, ok := m.executors[task.Type].(Renderer)
+	if !ok {
+		return nil, fmt.Errorf("交付类型 %s 不支持预览", task.Type)
+	}
+
+	clientset, dynamicClient, _, err := m.credentials.Clients(task.ClusterID)
+	if err != nil {
+		return nil, fmt.Errorf("获取Kubernetes客户端失败: %v", err)
+	}
+
+	reader, err := renderer.Render(ctx, task)
+	if err != nil {
+		return nil, err
+	}
+
+	applier := NewApplier(clientset, dynamicClient, task.Namespace, policy)
+	return applier.DryRun(ctx, reader)
+}
+
+// DryRun 以试运行方式服务端应用所有资源，返回每个资源当前状态与应用结果的差异
+// 单个资源试运行失败不影响其他资源，失败原因记录在结果中
+func (a *Applier) DryRun(ctx context.Context, reader *ManifestReader) ([]*ObjectDiff, error) {
+	manifests, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if err := SortManifests(manifests); err != nil {
+		return nil, err
+	}
+
+	diffs := make([]*ObjectDiff, 0, len(manifests))
+	for _, manifest := range manifests {
+		diffs = append(diffs, a.dryRunManifest(ctx, manifest))
+	}
+	return diffs, nil
+}
+
+// dryRunManifest 读取资源的当前状态并试运行服务端应用
+func (a *Applier) dryRunManifest(ctx context.Context, manifest *Manifest) *ObjectDiff {
+	obj := manifest.Object
+	result := &ObjectDiff{
+		Kind:     obj.GetKind(),
+		Name:     obj.GetName(),
+		Position: manifest.Position(),
+	}
+
+	resourceClient, err := a.resourceFor(obj)
+	result.Namespace = obj.GetNamespace()
+	if err != nil {
+		result.Action, result.Error = PreviewError, err.Error()
+		return result
+	}
+
+	live, err := resourceClient.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		live, err = nil, nil
+	}
+	if err != nil {
+		result.Action, result.Error = PreviewError, fmt.Sprintf("获取资源当前状态失败: %v", err)
+		return result
+	}
+
+	applied, err := resourceClient.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{
+		FieldManager: FieldManager,
+		Force:        a.policy == ConflictForce,
+		DryRun:       []string{metav1.DryRunAll},
+	})
+	if err != nil {
+		result.Action, result.Error = PreviewError, newApplyError(manifest, err).Message
+		return result
+	}
+
+	before, after := normalizeForDiff(live), normalizeForDiff(applied)
+	if gk := obj.GroupVersionKind().GroupKind(); gk.Group == "" && gk.Kind == "Secret" {
+		MaskSecretData(before, after)
+	}
+
+	diff, err := objectDiff(before, after)
+	if err != nil {
+		result.Action, result.Error = PreviewError, err.Error()
+		return result
+	}
+
+	switch {
+	case live == nil:
+		result.Action = PreviewCreate
+	case diff == "":
+		result.Action = PreviewUnchanged
+	default:
+		result.Action = PreviewUpdate
+	}
+	result.Diff = diff
+	return result
+}
+
+// normalizeForDiff 复制资源并移除由服务端维护的字段
+func normalizeForDiff(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	if obj == nil {
+		return nil
+	}
+	obj = obj.DeepCopy()
+	for _, field := range ignoredPreviewFields {
+		unstructured.RemoveNestedField(obj.Object, field...)
+	}
+	return obj
+}
+
+// MaskSecretData 屏蔽Secret的数据，只保留键以及值是否变化，after为nil时屏蔽before的全部数据
+// 包含明文数据的last-applied-configuration注解同样被屏蔽
+func MaskSecretData(before, after *unstructured.Unstructured) {
+	for _, obj := range []*unstructured.Unstructured{before, after} {
+		if obj == nil {
+			continue
+		}
+		if annotations := obj.GetAnnotations(); annotations[lastAppliedAnnotation] != "" {
+			annotations[lastAppliedAnnotation] = secretMask
+			obj.SetAnnotations(annotations)
+		}
+	}
+
+	for _, field := range []string{"data", "stringData"} {
+		var beforeData, afterData map[string]interface{}
+		if before != nil {
+			beforeData, _, _ = unstructured.NestedMap(before.Object, field)
+		}
+		if after != nil {
+			afterData, _, _ = unstructured.NestedMap(after.Object, field)
+		}
+
+		for key, value := range beforeData {
+			afterValue, ok := afterData[key]
+			switch {
+			case !ok:
+				beforeData[key] = secretMask
+			case reflect.DeepEqual(value, afterValue):
+				beforeData[key], afterData[key] = secretMask, secretMask
+			default:
+				beforeData[key], afterData[key] = secretMask+" (before)", secretMask+" (after)"
+			}
+		}
+		for key := range afterData {
+			if _, ok := beforeData[key]; !ok {
+				afterData[key] = secretMask
+			}
+		}
+
+		if beforeData != nil {
+			_ = unstructured.SetNestedMap(before.Object, beforeData, field)
+		}
+		if afterData != nil {
+			_ = unstructured.SetNestedMap(after.Object, afterData, field)
+		}
+	}
+}
+
+// objectDiff 返回两个资源YAML之间的统一差异，没有变化时返回空字符串
+func objectDiff(before, after *unstructured.Unstructured) (string, error) {
+	a, err := objectYAML(before)
+	if err != nil {
+		return "", err
+	}
+	b, err := objectYAML(after)
+	if err != nil {
+		return "", err
+	}
+	if a == b {
+		return "", nil
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        diffLines(a),
+		B:        diffLines(b),
+		FromFile: "live",
+		ToFile:   "dry-run",
+		Context:  3,
+	})
+}
+
+// diffLines 按行拆分YAML，空内容没有任何行
+func diffLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return difflib.SplitLines(strings.TrimSuffix(s, "\n"))
+}
+
+// objectYAML 将资源序列化为YAML，资源不存在时为空
+func objectYAML(obj *unstructured.Unstructured) (string, error) {
+	if obj == nil {
+		return "", nil
+	}
+	data, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return "", fmt.Errorf("序列化资源 %s %s 失败: %v", obj.GetKind(), objectRef(obj), err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,93 @@
+package delivery
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// testSecret 创建测试用的Secret，data为nil时不设置data字段
+func testSecret(data map[string]interface{}, annotations map[string]string) *unstructured.Unstructured {
+	obj := testObject("v1", "Secret", map[string]interface{}{})
+	if data != nil {
+		obj.Object["data"] = data
+	}
+	if annotations != nil {
+		obj.SetAnnotations(annotations)
+	}
+	return obj
+}
+
+func TestMaskSecretData(t *testing.T) {
+	tests := []struct {
+		name       string
+		before     *unstructured.Unstructured
+		after      *unstructured.Unstructured
+		wantBefore map[string]interface{}
+		wantAfter  map[string]interface{}
+	}{
+		{
+			name:       "mask all data",
+			before:     testSecret(map[string]interface{}{"password": "c2VjcmV0", "user": "YWRtaW4="}, nil),
+			wantBefore: map[string]interface{}{"password": "***", "user": "***"},
+		},
+		{
+			name:       "changed, unchanged, added and removed keys",
+			before:     testSecret(map[string]interface{}{"same": "YQ==", "changed": "Yg==", "removed": "Yw=="}, nil),
+			after:      testSecret(map[string]interface{}{"same": "YQ==", "changed": "ZA==", "added": "ZQ=="}, nil),
+			wantBefore: map[string]interface{}{"same": "***", "changed": "*** (before)", "removed": "***"},
+			wantAfter:  map[string]interface{}{"same": "***", "changed": "*** (after)", "added": "***"},
+		},
+		{
+			name:      "created secret",
+			after:     testSecret(map[string]interface{}{"token": "dA=="}, nil),
+			wantAfter: map[string]interface{}{"token": "***"},
+		},
+		{
+			name:   "secret without data",
+			before: testSecret(nil, nil),
+			after:  testSecret(nil, nil),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			MaskSecretData(tt.before, tt.after)
+			if tt.before != nil {
+				got, _, _ := unstructured.NestedMap(tt.before.Object, "data")
+				if !reflect.DeepEqual(got, tt.wantBefore) {
+					t.Errorf("before data = %v, want %v", got, tt.wantBefore)
+				}
+			}
+			if tt.after != nil {
+				got, _, _ := unstructured.NestedMap(tt.after.Object, "data")
+				if !reflect.DeepEqual(got, tt.wantAfter) {
+					t.Errorf("after data = %v, want %v", got, tt.wantAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestMaskSecretDataStringDataAndAnnotation(t *testing.T) {
+	obj := testSecret(nil, map[string]string{
+		lastAppliedAnnotation: `{"stringData":{"password":"secret"}}`,
+		"team":                "platform",
+	})
+	obj.Object["stringData"] = map[string]interface{}{"password": "secret"}
+
+	MaskSecretData(obj, nil)
+
+	stringData, _, _ := unstructured.NestedMap(obj.Object, "stringData")
+	if want := map[string]interface{}{"password": "***"}; !reflect.DeepEqual(stringData, want) {
+		t.Errorf("stringData = %v, want %v", stringData, want)
+	}
+	annotations := obj.GetAnnotations()
+	if annotations[lastAppliedAnnotation] != secretMask {
+		t.Errorf("%s = %q, want %q", lastAppliedAnnotation, annotations[lastAppliedAnnotation], secretMask)
+	}
+	if annotations["team"] != "platform" {
+		t.Errorf("team annotation = %q, want unchanged", annotations["team"])
+	}
+}
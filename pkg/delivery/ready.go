@@ -0,0 +1,360 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// DefaultWaitTimeout 未指定超时时间时等待资源就绪的时间
+	DefaultWaitTimeout = 5 * time.Minute
+	// readinessPollInterval 检查资源就绪状态的间隔
+	readinessPollInterval = 2 * time.Second
+)
+
+// ReadinessStatus 资源的就绪状态，与kstatus的状态含义一致
+type ReadinessStatus string
+
+const (
+	// ReadinessCurrent 资源已就绪
+	ReadinessCurrent ReadinessStatus = "Current"
+	// ReadinessInProgress 资源尚未就绪
+	ReadinessInProgress ReadinessStatus = "InProgress"
+	// ReadinessFailed 资源无法就绪，例如Job失败或Deployment超过进度期限
+	ReadinessFailed ReadinessStatus = "Failed"
+	// ReadinessNotFound 资源不存在
+	ReadinessNotFound ReadinessStatus = "NotFound"
+)
+
+// ObjectReadiness 单个资源的就绪状态
+type ObjectReadiness struct {
+	Kind      string          `json:"kind"`
+	Namespace string          `json:"namespace,omitempty"`
+	Name      string          `json:"name"`
+	Status    ReadinessStatus `json:"status"`
+	Message   string          `json:"message,omitempty"`
+}
+
+// WaitForReady 等待所有已应用的资源就绪，超时或有资源失败时返回错误
+// 每个资源的最终状态记录到任务的Readiness中
+func (a *Applier) WaitForReady(ctx context.Context, timeout time.Duration) error {
+	logger := LoggerFromContext(ctx)
+	if timeout <= 0 {
+		timeout = DefaultWaitTimeout
+	}
+	logger.Infof(LogSourceWait, "等待 %d 个资源就绪，超时时间 %s", len(a.applied), timeout)
+
+	report := make([]*ObjectReadiness, len(a.applied))
+	for i, resource := range a.applied {
+		report[i] = &ObjectReadiness{
+			Kind:      resource.object.GetKind(),
+			Namespace: resource.object.GetNamespace(),
+			Name:      resource.object.GetName(),
+			Status:    ReadinessInProgress,
+		}
+	}
+	defer RecordReadiness(ctx, report...)
+
+	statusSubresources := a.statusSubresources(ctx)
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(readinessPollInterval)
+	defer ticker.Stop()
+
+	for {
+		pending, failed := 0, 0
+		for i, resource := range a.applied {
+			readiness := report[i]
+			if readiness.Status == ReadinessCurrent || readiness.Status == ReadinessFailed {
+				continue
+			}
+
+			status, message := ReadinessNotFound, "资源不存在"
+			obj, err := resource.client.Get(waitCtx, readiness.Name, metav1.GetOptions{})
+			switch {
+			case err == nil:
+				status, message = computeReadiness(obj, statusSubresources[i])
+			case !apierrors.IsNotFound(err):
+				status, message = ReadinessInProgress, err.Error()
+			}
+
+			if status != readiness.Status {
+				logger.Infof(LogSourceWait, "资源 %s %s: %s %s", readiness.Kind, objectRef(resource.object), status, message)
+			}
+			readiness.Status, readiness.Message = status, message
+
+			switch status {
+			case ReadinessCurrent:
+			case ReadinessFailed:
+				failed++
+			default:
+				pending++
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d 个资源无法就绪", failed)
+		}
+		if pending == 0 {
+			logger.Infof(LogSourceWait, "所有资源已就绪")
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-waitCtx.Done():
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return ctx.Err()
+			}
+			return fmt.Errorf("等待资源就绪超时，%d 个资源未就绪", pending)
+		}
+	}
+}
+
+// statusSubresources 查询每个已应用资源的CRD是否启用了status子资源
+// 内置资源以及无法查询CRD的资源视为未启用
+func (a *Applier) statusSubresources(ctx context.Context) []bool {
+	enabled := make([]bool, len(a.applied))
+	cache := make(map[schema.GroupVersionResource]bool)
+	for i, resource := range a.applied {
+		mapping, err := a.mapper.RESTMapping(resource.object.GroupVersionKind())
+		if err != nil {
+			continue
+		}
+		found, ok := cache[mapping.Resource]
+		if !ok {
+			found = a.hasStatusSubresource(ctx, mapping.Resource)
+			cache[mapping.Resource] = found
+		}
+		enabled[i] = found
+	}
+	return enabled
+}
+
+// hasStatusSubresource 资源的CRD在对应版本上是否启用了status子资源
+// 自定义资源的组名必须包含"."，核心组和不含"."的内置组不查询CRD
+func (a *Applier) hasStatusSubresource(ctx context.Context, gvr schema.GroupVersionResource) bool {
+	if !strings.Contains(gvr.Group, ".") {
+		return false
+	}
+	crd, err := a.dynamicClient.Resource(crdResource).Get(ctx, gvr.Resource+"."+gvr.Group, metav1.GetOptions{})
+	if err != nil {
+		return false
+	}
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, item := range versions {
+		version, ok := item.(map[string]interface{})
+		if !ok || version["name"] != gvr.Version {
+			continue
+		}
+		_, found, _ := unstructured.NestedMap(version, "subresources", "status")
+		return found
+	}
+	return false
+}
+
+// computeReadiness 根据资源类型判断资源是否就绪
+// statusSubresource 表示资源的CRD启用了status子资源，此时资源需要由控制器写入status后才能就绪
+func computeReadiness(obj *unstructured.Unstructured, statusSubresource bool) (ReadinessStatus, string) {
+	// 控制器尚未处理最新的spec
+	if observed, found, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration"); found && observed < obj.GetGeneration() {
+		return ReadinessInProgress, "等待控制器处理最新的配置"
+	}
+
+	gk := obj.GroupVersionKind().GroupKind()
+	switch gk.Group + "/" + gk.Kind {
+	case "apps/Deployment":
+		return deploymentReadiness(obj)
+	case "apps/StatefulSet":
+		return statefulSetReadiness(obj)
+	case "apps/DaemonSet":
+		return daemonSetReadiness(obj)
+	case "batch/Job":
+		return jobReadiness(obj)
+	case "/PersistentVolumeClaim":
+		phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		if phase == "Bound" {
+			return ReadinessCurrent, ""
+		}
+		return ReadinessInProgress, fmt.Sprintf("PVC处于%s状态", phase)
+	case "/Pod":
+		return podReadiness(obj)
+	case "/Service":
+		return serviceReadiness(obj)
+	case "/Namespace":
+		phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		if phase == "Terminating" {
+			return ReadinessInProgress, "命名空间正在删除"
+		}
+		return ReadinessCurrent, ""
+	}
+
+	return genericReadiness(obj, statusSubresource)
+}
+
+// deploymentReadiness Deployment所有副本都已更新且可用，并且没有旧副本
+func deploymentReadiness(obj *unstructured.Unstructured) (ReadinessStatus, string) {
+	if condition := findCondition(obj, "Progressing"); condition != nil && condition["reason"] == "ProgressDeadlineExceeded" {
+		return ReadinessFailed, fmt.Sprint(condition["message"])
+	}
+
+	replicas := specReplicas(obj)
+	updated := statusInt(obj, "updatedReplicas")
+	ready := statusInt(obj, "readyReplicas")
+	available := statusInt(obj, "availableReplicas")
+	total := statusInt(obj, "replicas")
+
+	switch {
+	case updated < replicas:
+		return ReadinessInProgress, fmt.Sprintf("已更新 %d/%d 个副本", updated, replicas)
+	case total > updated:
+		return ReadinessInProgress, fmt.Sprintf("%d 个旧副本等待终止", total-updated)
+	case available < replicas || ready < replicas:
+		return ReadinessInProgress, fmt.Sprintf("可用 %d/%d 个副本", available, replicas)
+	}
+	return ReadinessCurrent, fmt.Sprintf("%d 个副本已就绪", replicas)
+}
+
+// statefulSetReadiness StatefulSet所有副本都已更新并就绪
+func statefulSetReadiness(obj *unstructured.Unstructured) (ReadinessStatus, string) {
+	replicas := specReplicas(obj)
+	ready := statusInt(obj, "readyReplicas")
+
+	strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type")
+	if strategy != "OnDelete" {
+		partition, _, _ := unstructured.NestedInt64(obj.Object, "spec", "updateStrategy", "rollingUpdate", "partition")
+		updated := statusInt(obj, "updatedReplicas")
+		if updated < replicas-partition {
+			return ReadinessInProgress, fmt.Sprintf("已更新 %d/%d 个副本", updated, replicas-partition)
+		}
+		if partition == 0 {
+			current, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+			update, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+			if current != update {
+				return ReadinessInProgress, "等待滚动更新完成"
+			}
+		}
+	}
+
+	if ready < replicas {
+		return ReadinessInProgress, fmt.Sprintf("就绪 %d/%d 个副本", ready, replicas)
+	}
+	return ReadinessCurrent, fmt.Sprintf("%d 个副本已就绪", replicas)
+}
+
+// daemonSetReadiness DaemonSet在所有节点上都已更新并可用
+func daemonSetReadiness(obj *unstructured.Unstructured) (ReadinessStatus, string) {
+	desired := statusInt(obj, "desiredNumberScheduled")
+	updated := statusInt(obj, "updatedNumberScheduled")
+	available := statusInt(obj, "numberAvailable")
+
+	switch {
+	case updated < desired:
+		return ReadinessInProgress, fmt.Sprintf("已更新 %d/%d 个节点", updated, desired)
+	case available < desired:
+		return ReadinessInProgress, fmt.Sprintf("可用 %d/%d 个节点", available, desired)
+	}
+	return ReadinessCurrent, fmt.Sprintf("%d 个节点已就绪", desired)
+}
+
+// jobReadiness Job执行完成
+func jobReadiness(obj *unstructured.Unstructured) (ReadinessStatus, string) {
+	if condition := findCondition(obj, "Failed"); condition != nil && condition["status"] == "True" {
+		return ReadinessFailed, fmt.Sprint(condition["message"])
+	}
+	if condition := findCondition(obj, "Complete"); condition != nil && condition["status"] == "True" {
+		return ReadinessCurrent, "执行完成"
+	}
+	return ReadinessInProgress, fmt.Sprintf("成功 %d 个Pod", statusInt(obj, "succeeded"))
+}
+
+// podReadiness Pod运行且就绪，或已成功结束
+func podReadiness(obj *unstructured.Unstructured) (ReadinessStatus, string) {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	switch phase {
+	case "Succeeded":
+		return ReadinessCurrent, "执行完成"
+	case "Failed":
+		return ReadinessFailed, "Pod执行失败"
+	case "Running":
+		if condition := findCondition(obj, "Ready"); condition != nil && condition["status"] == "True" {
+			return ReadinessCurrent, ""
+		}
+	}
+	return ReadinessInProgress, fmt.Sprintf("Pod处于%s状态", phase)
+}
+
+// serviceReadiness LoadBalancer类型的Service需要分配到外部地址
+func serviceReadiness(obj *unstructured.Unstructured) (ReadinessStatus, string) {
+	serviceType, _, _ := unstructured.NestedString(obj.Object, "spec", "type")
+	if serviceType != "LoadBalancer" {
+		return ReadinessCurrent, ""
+	}
+	ingress, _, _ := unstructured.NestedSlice(obj.Object, "status", "loadBalancer", "ingress")
+	if len(ingress) == 0 {
+		return ReadinessInProgress, "等待分配负载均衡地址"
+	}
+	return ReadinessCurrent, ""
+}
+
+// genericReadiness 其他资源（包括自定义资源）根据Ready条件判断
+// 启用了status子资源的自定义资源在控制器写入status之前视为未就绪；
+// 没有status子资源的资源以及没有Ready条件的资源视为已就绪
+func genericReadiness(obj *unstructured.Unstructured, statusSubresource bool) (ReadinessStatus, string) {
+	if _, found := obj.Object["status"]; statusSubresource && !found {
+		return ReadinessInProgress, "等待控制器更新状态"
+	}
+	if condition := findCondition(obj, "Stalled"); condition != nil && condition["status"] == "True" {
+		return ReadinessFailed, fmt.Sprint(condition["message"])
+	}
+
+	condition := findCondition(obj, "Ready")
+	if condition == nil {
+		return ReadinessCurrent, ""
+	}
+	if condition["status"] == "True" {
+		return ReadinessCurrent, ""
+	}
+	message, _ := condition["message"].(string)
+	if message == "" {
+		message, _ = condition["reason"].(string)
+	}
+	return ReadinessInProgress, message
+}
+
+// findCondition 查找status.conditions中指定类型的条件
+func findCondition(obj *unstructured.Unstructured, conditionType string) map[string]interface{} {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, item := range conditions {
+		condition, ok := item.(map[string]interface{})
+		if ok && condition["type"] == conditionType {
+			return condition
+		}
+	}
+	return nil
+}
+
+// specReplicas 返回spec.replicas，未设置时为1
+func specReplicas(obj *unstructured.Unstructured) int64 {
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		return 1
+	}
+	return replicas
+}
+
+// statusInt 返回status中的整数字段，未设置时为0
+func statusInt(obj *unstructured.Unstructured, field string) int64 {
+	value, _, _ := unstructured.NestedInt64(obj.Object, "status", field)
+	return value
+}
@@ -0,0 +1,289 @@
+package delivery
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// testObject 创建测试用的资源
+func testObject(apiVersion, kind string, fields map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: fields}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetName("test")
+	return obj
+}
+
+// readyCondition 创建status.conditions中的一个条件
+func readyCondition(conditionType, status string) map[string]interface{} {
+	return map[string]interface{}{"type": conditionType, "status": status, "message": conditionType + " " + status}
+}
+
+func TestComputeReadiness(t *testing.T) {
+	tests := []struct {
+		name              string
+		obj               *unstructured.Unstructured
+		statusSubresource bool
+		want              ReadinessStatus
+	}{
+		{
+			name: "deployment ready",
+			obj: testObject("apps/v1", "Deployment", map[string]interface{}{
+				"metadata": map[string]interface{}{"generation": int64(2)},
+				"spec":     map[string]interface{}{"replicas": int64(2)},
+				"status": map[string]interface{}{
+					"observedGeneration": int64(2), "replicas": int64(2), "updatedReplicas": int64(2),
+					"readyReplicas": int64(2), "availableReplicas": int64(2),
+				},
+			}),
+			want: ReadinessCurrent,
+		},
+		{
+			name: "deployment generation not observed",
+			obj: testObject("apps/v1", "Deployment", map[string]interface{}{
+				"metadata": map[string]interface{}{"generation": int64(3)},
+				"spec":     map[string]interface{}{"replicas": int64(1)},
+				"status": map[string]interface{}{
+					"observedGeneration": int64(2), "replicas": int64(1), "updatedReplicas": int64(1),
+					"readyReplicas": int64(1), "availableReplicas": int64(1),
+				},
+			}),
+			want: ReadinessInProgress,
+		},
+		{
+			name: "deployment old replicas",
+			obj: testObject("apps/v1", "Deployment", map[string]interface{}{
+				"spec": map[string]interface{}{"replicas": int64(1)},
+				"status": map[string]interface{}{
+					"replicas": int64(2), "updatedReplicas": int64(1), "readyReplicas": int64(2), "availableReplicas": int64(2),
+				},
+			}),
+			want: ReadinessInProgress,
+		},
+		{
+			name: "deployment progress deadline exceeded",
+			obj: testObject("apps/v1", "Deployment", map[string]interface{}{
+				"status": map[string]interface{}{
+					"conditions": []interface{}{map[string]interface{}{
+						"type": "Progressing", "status": "False", "reason": "ProgressDeadlineExceeded",
+					}},
+				},
+			}),
+			want: ReadinessFailed,
+		},
+		{
+			name: "statefulset rolling update in progress",
+			obj: testObject("apps/v1", "StatefulSet", map[string]interface{}{
+				"spec": map[string]interface{}{"replicas": int64(2)},
+				"status": map[string]interface{}{
+					"updatedReplicas": int64(2), "readyReplicas": int64(2),
+					"currentRevision": "web-1", "updateRevision": "web-2",
+				},
+			}),
+			want: ReadinessInProgress,
+		},
+		{
+			name: "statefulset partitioned update",
+			obj: testObject("apps/v1", "StatefulSet", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"replicas":       int64(3),
+					"updateStrategy": map[string]interface{}{"type": "RollingUpdate", "rollingUpdate": map[string]interface{}{"partition": int64(2)}},
+				},
+				"status": map[string]interface{}{"updatedReplicas": int64(1), "readyReplicas": int64(3)},
+			}),
+			want: ReadinessCurrent,
+		},
+		{
+			name: "daemonset not available",
+			obj: testObject("apps/v1", "DaemonSet", map[string]interface{}{
+				"status": map[string]interface{}{
+					"desiredNumberScheduled": int64(3), "updatedNumberScheduled": int64(3), "numberAvailable": int64(2),
+				},
+			}),
+			want: ReadinessInProgress,
+		},
+		{
+			name: "job complete",
+			obj: testObject("batch/v1", "Job", map[string]interface{}{
+				"status": map[string]interface{}{"conditions": []interface{}{readyCondition("Complete", "True")}},
+			}),
+			want: ReadinessCurrent,
+		},
+		{
+			name: "job failed",
+			obj: testObject("batch/v1", "Job", map[string]interface{}{
+				"status": map[string]interface{}{"conditions": []interface{}{readyCondition("Failed", "True")}},
+			}),
+			want: ReadinessFailed,
+		},
+		{
+			name: "pvc pending",
+			obj: testObject("v1", "PersistentVolumeClaim", map[string]interface{}{
+				"status": map[string]interface{}{"phase": "Pending"},
+			}),
+			want: ReadinessInProgress,
+		},
+		{
+			name: "pod running but not ready",
+			obj: testObject("v1", "Pod", map[string]interface{}{
+				"status": map[string]interface{}{"phase": "Running", "conditions": []interface{}{readyCondition("Ready", "False")}},
+			}),
+			want: ReadinessInProgress,
+		},
+		{
+			name: "pod succeeded",
+			obj: testObject("v1", "Pod", map[string]interface{}{
+				"status": map[string]interface{}{"phase": "Succeeded"},
+			}),
+			want: ReadinessCurrent,
+		},
+		{
+			name: "load balancer without ingress",
+			obj: testObject("v1", "Service", map[string]interface{}{
+				"spec": map[string]interface{}{"type": "LoadBalancer"},
+			}),
+			want: ReadinessInProgress,
+		},
+		{
+			name: "cluster ip service",
+			obj:  testObject("v1", "Service", map[string]interface{}{"spec": map[string]interface{}{"type": "ClusterIP"}}),
+			want: ReadinessCurrent,
+		},
+		{
+			name: "terminating namespace",
+			obj: testObject("v1", "Namespace", map[string]interface{}{
+				"status": map[string]interface{}{"phase": "Terminating"},
+			}),
+			want: ReadinessInProgress,
+		},
+		{
+			name: "configmap",
+			obj:  testObject("v1", "ConfigMap", map[string]interface{}{}),
+			want: ReadinessCurrent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, message := computeReadiness(tt.obj, tt.statusSubresource); got != tt.want {
+				t.Errorf("computeReadiness() = %s (%s), want %s", got, message, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenericReadiness(t *testing.T) {
+	tests := []struct {
+		name              string
+		fields            map[string]interface{}
+		statusSubresource bool
+		want              ReadinessStatus
+	}{
+		{
+			name: "no status without status subresource",
+			want: ReadinessCurrent,
+		},
+		{
+			name:              "no status with status subresource",
+			statusSubresource: true,
+			want:              ReadinessInProgress,
+		},
+		{
+			name:              "status without ready condition",
+			fields:            map[string]interface{}{"status": map[string]interface{}{"phase": "Active"}},
+			statusSubresource: true,
+			want:              ReadinessCurrent,
+		},
+		{
+			name: "ready condition true",
+			fields: map[string]interface{}{
+				"status": map[string]interface{}{"conditions": []interface{}{readyCondition("Ready", "True")}},
+			},
+			statusSubresource: true,
+			want:              ReadinessCurrent,
+		},
+		{
+			name: "ready condition false",
+			fields: map[string]interface{}{
+				"status": map[string]interface{}{"conditions": []interface{}{readyCondition("Ready", "False")}},
+			},
+			want: ReadinessInProgress,
+		},
+		{
+			name: "stalled",
+			fields: map[string]interface{}{
+				"status": map[string]interface{}{"conditions": []interface{}{
+					readyCondition("Ready", "False"), readyCondition("Stalled", "True"),
+				}},
+			},
+			want: ReadinessFailed,
+		},
+		{
+			name: "generation not observed",
+			fields: map[string]interface{}{
+				"metadata": map[string]interface{}{"generation": int64(2)},
+				"status": map[string]interface{}{
+					"observedGeneration": int64(1),
+					"conditions":         []interface{}{readyCondition("Ready", "True")},
+				},
+			},
+			statusSubresource: true,
+			want:              ReadinessInProgress,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := tt.fields
+			if fields == nil {
+				fields = map[string]interface{}{}
+			}
+			obj := testObject("example.com/v1", "Widget", fields)
+			if got, message := computeReadiness(obj, tt.statusSubresource); got != tt.want {
+				t.Errorf("computeReadiness() = %s (%s), want %s", got, message, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasStatusSubresource(t *testing.T) {
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": "widgets.example.com"},
+		"spec": map[string]interface{}{
+			"versions": []interface{}{
+				map[string]interface{}{"name": "v1", "subresources": map[string]interface{}{"status": map[string]interface{}{}}},
+				map[string]interface{}{"name": "v1beta1"},
+			},
+		},
+	}}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{crdResource: "CustomResourceDefinitionList"}, crd)
+	applier := &Applier{dynamicClient: client}
+
+	tests := []struct {
+		name string
+		gvr  schema.GroupVersionResource
+		want bool
+	}{
+		{name: "status subresource", gvr: schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}, want: true},
+		{name: "version without status subresource", gvr: schema.GroupVersionResource{Group: "example.com", Version: "v1beta1", Resource: "widgets"}},
+		{name: "unknown crd", gvr: schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "gadgets"}},
+		{name: "core group", gvr: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}},
+		{name: "built-in group", gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := applier.hasStatusSubresource(context.Background(), tt.gvr); got != tt.want {
+				t.Errorf("hasStatusSubresource() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package delivery
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrTaskNotFound 交付任务不存在
+	ErrTaskNotFound = errors.New("交付任务不存在")
+	// ErrIdempotencyKeyReused 幂等键已被内容不同的部署请求使用
+	ErrIdempotencyKeyReused = errors.New("幂等键已被内容不同的部署请求使用")
+)
+
+const (
+	// DefaultTaskPageSize 任务列表默认分页大小
+	DefaultTaskPageSize = 20
+	// MaxTaskPageSize 任务列表分页大小上限
+	MaxTaskPageSize = 100
+)
+
+// idempotencyKeyContextKey 幂等键在上下文中的键
+type idempotencyKeyContextKey struct{}
+
+// WithIdempotencyKey 将客户端提供的幂等键附加到上下文
+// 相同幂等键的重复提交会返回最初创建的任务，而不会再次部署
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	if key == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// idempotencyKeyFromContext 从上下文中获取幂等键
+func idempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyContextKey{}).(string)
+	return key
+}
+
+// newTaskID 生成按时间排序且不会冲突的任务ID
+func newTaskID() (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", fmt.Errorf("生成任务ID失败: %v", err)
+	}
+	return "task-" + id.String(), nil
+}
+
+// requestHash 计算部署请求的摘要，用于识别重复使用幂等键的不同请求
+func requestHash(taskType DeliveryType, config string) string {
+	sum := sha256.Sum256([]byte(string(taskType) + "\n" + config))
+	return hex.EncodeToString(sum[:])
+}
+
+// bundleRequestHash 计算上传交付包的Kustomize请求摘要，路径换算为交付包内的相对路径
+func bundleRequestHash(options *KustomizeOptions) string {
+	relative := *options
+	relative.BasePath, _ = filepath.Rel(options.BundleDir, options.BasePath)
+	if options.OverlayPath != "" {
+		relative.OverlayPath, _ = filepath.Rel(options.BundleDir, options.OverlayPath)
+	}
+	config, _ := json.Marshal(&relative)
+	return requestHash(TypeKustomize, string(config)+"\n"+options.BundleDigest)
+}
+
+// TaskFilter 交付任务查询条件，Limit不大于0时使用默认分页大小，超过上限时按上限返回
+type TaskFilter struct {
+	ClusterID string
+	Namespace string
+	Type      DeliveryType
+	Status    DeliveryStatus
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+	Offset    int
+}
+
+// newTask 创建一个等待中的交付任务，并将部署选项序列化到Config中
+func newTask(taskType DeliveryType, name, clusterID, clusterName, namespace string, options interface{}) (*DeliveryTask, error) {
+	id, err := newTaskID()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := json.Marshal(options)
+	if err != nil {
+		return nil, fmt.Errorf("序列化部署选项失败: %v", err)
+	}
+
+	now := time.Now()
+	return &DeliveryTask{
+		ID:          id,
+		Name:        name,
+		Type:        taskType,
+		Status:      StatusPending,
+		ClusterID:   clusterID,
+		ClusterName: clusterName,
+		Namespace:   namespace,
+		Config:      string(config),
+		RequestHash: requestHash(taskType, string(config)),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, nil
+}
+
+// submitTask 保存任务并加入执行队列
+// 上下文携带幂等键时，若已存在相同幂等键且请求相同的任务则直接返回该任务，
+// 请求内容或交付类型不同时返回ErrIdempotencyKeyReused
+func (m *Manager) submitTask(ctx context.Context, task *DeliveryTask) (*DeliveryTask, error) {
+	if _, ok := m.executors[task.Type]; !ok {
+		return nil, fmt.Errorf("不支持的交付类型: %s", task.Type)
+	}
+
+	key := idempotencyKeyFromContext(ctx)
+	if key != "" {
+		existing, err := m.getTaskByIdempotencyKey(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return sameRequest(existing, task)
+		}
+		task.IdempotencyKey = &key
+	}
+
+	if err := m.storageFactory.GetDB().WithContext(ctx).Create(task).Error; err != nil {
+		// 并发提交相同幂等键时由唯一索引兜底，返回先提交成功的任务
+		if key != "" {
+			if existing, _ := m.getTaskByIdempotencyKey(ctx, key); existing != nil {
+				return sameRequest(existing, task)
+			}
+		}
+		return nil, fmt.Errorf("保存交付任务失败: %v", err)
+	}
+
+	m.pool.notify()
+	return task, nil
+}
+
+// sameRequest 幂等键命中已有任务时校验两次请求一致，一致时返回已有任务
+func sameRequest(existing, task *DeliveryTask) (*DeliveryTask, error) {
+	if existing.RequestHash != task.RequestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	return existing, nil
+}
+
+// getTaskByIdempotencyKey 按幂等键查询任务，不存在时返回nil
+func (m *Manager) getTaskByIdempotencyKey(ctx context.Context, key string) (*DeliveryTask, error) {
+	var task DeliveryTask
+	err := m.storageFactory.GetDB().WithContext(ctx).First(&task, "idempotency_key = ?", key).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询交付任务失败: %v", err)
+	}
+	return &task, nil
+}
+
+// updateTaskStatus 更新任务状态到数据库
+func (m *Manager) updateTaskStatus(task *DeliveryTask, status DeliveryStatus, message string) error {
+	task.Status = status
+	task.Message = message
+	task.UpdatedAt = time.Now()
+
+	err := m.storageFactory.GetDB().Model(task).
+		Select("status", "message", "errors", "readiness", "pruned", "updated_at").
+		Updates(task).Error
+	if err != nil {
+		return fmt.Errorf("更新交付任务状态失败: %v", err)
+	}
+	return nil
+}
+
+// listPendingTasks 按创建顺序获取等待中的任务，任务ID按时间排序
+func (m *Manager) listPendingTasks() ([]*DeliveryTask, error) {
+	tasks := make([]*DeliveryTask, 0)
+	err := m.storageFactory.GetDB().
+		Where("status = ?", StatusPending).
+		Order("id ASC").
+		Find(&tasks).Error
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// claimTask 将等待中的任务标记为运行中，任务已被领取或取消时返回false
+func (m *Manager) claimTask(task *DeliveryTask) (bool, error) {
+	now := time.Now()
+	result := m.storageFactory.GetDB().Model(&DeliveryTask{}).
+		Where("id = ? AND status = ?", task.ID, StatusPending).
+		Updates(map[string]interface{}{
+			"status":     StatusRunning,
+			"updated_at": now,
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("领取交付任务失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	task.Status = StatusRunning
+	task.UpdatedAt = now
+	return true, nil
+}
+
+// requeueRunningTasks 将上次退出时中断的任务重新置为等待中
+func (m *Manager) requeueRunningTasks() error {
+	err := m.storageFactory.GetDB().Model(&DeliveryTask{}).
+		Where("status = ?", StatusRunning).
+		Updates(map[string]interface{}{
+			"status":     StatusPending,
+			"updated_at": time.Now(),
+		}).Error
+	if err != nil {
+		return fmt.Errorf("恢复中断的交付任务失败: %v", err)
+	}
+	return nil
+}
+
+// cancelPendingTask 取消等待中的任务，任务不处于等待状态时返回false
+func (m *Manager) cancelPendingTask(id string) (bool, error) {
+	result := m.storageFactory.GetDB().Model(&DeliveryTask{}).
+		Where("id = ? AND status = ?", id, StatusPending).
+		Updates(map[string]interface{}{
+			"status":     StatusCancelled,
+			"message":    "任务已取消",
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("取消交付任务失败: %v", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetTask 获取交付任务
+func (m *Manager) GetTask(ctx context.Context, id string) (*DeliveryTask, error) {
+	var task DeliveryTask
+	if err := m.storageFactory.GetDB().WithContext(ctx).First(&task, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTaskNotFound
+		}
+		return nil, fmt.Errorf("查询交付任务失败: %v", err)
+	}
+	return &task, nil
+}
+
+// ListTasks 按条件查询交付任务，返回当前页的任务和总数
+func (m *Manager) ListTasks(ctx context.Context, filter *TaskFilter) ([]*DeliveryTask, int64, error) {
+	query := m.storageFactory.GetDB().WithContext(ctx).Model(&DeliveryTask{})
+
+	if filter.ClusterID != "" {
+		query = query.Where("cluster_id = ?", filter.ClusterID)
+	}
+	if filter.Namespace != "" {
+		query = query.Where("namespace = ?", filter.Namespace)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at <= ?", filter.Until)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("统计交付任务失败: %v", err)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultTaskPageSize
+	} else if limit > MaxTaskPageSize {
+		limit = MaxTaskPageSize
+	}
+	query = query.Limit(limit)
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+
+	tasks := make([]*DeliveryTask, 0)
+	if err := query.Order("created_at DESC").Find(&tasks).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询交付任务列表失败: %v", err)
+	}
+	return tasks, total, nil
+}
@@ -0,0 +1,19 @@
+package delivery
+
+import "testing"
+
+func TestSameRequest(t *testing.T) {
+	first, err := newTask(TypeYAML, "app", "c1", "", "default", &YAMLOptions{Name: "app", ClusterID: "c1", Content: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	same, _ := newTask(TypeYAML, "app", "c1", "", "default", &YAMLOptions{Name: "app", ClusterID: "c1", Content: "a"})
+	changed, _ := newTask(TypeYAML, "app", "c1", "", "default", &YAMLOptions{Name: "app", ClusterID: "c1", Content: "b"})
+
+	if got, err := sameRequest(first, same); err != nil || got != first {
+		t.Errorf("sameRequest() = %v, %v, want existing task", got, err)
+	}
+	if _, err := sameRequest(first, changed); err != ErrIdempotencyKeyReused {
+		t.Errorf("sameRequest() error = %v, want ErrIdempotencyKeyReused", err)
+	}
+}
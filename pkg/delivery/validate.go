@@ -0,0 +1,109 @@
+package delivery
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// maxWaitTimeout 等待资源就绪的最长超时时间（秒）
+const maxWaitTimeout = 3600
+
+// Validate 校验YAML部署选项
+func (o *YAMLOptions) Validate() error {
+	if err := validateTarget(o.Name, o.ClusterID, o.Namespace); err != nil {
+		return err
+	}
+	if strings.TrimSpace(o.Content) == "" {
+		return fmt.Errorf("YAML内容不能为空")
+	}
+	if err := validateTimeout(o.Timeout); err != nil {
+		return err
+	}
+	return validateConflictPolicy(o.ConflictPolicy)
+}
+
+// Validate 校验Helm部署选项，Chart来源必须且只能是本地路径或Chart名称之一
+func (o *HelmOptions) Validate() error {
+	if err := validateTarget(o.Name, o.ClusterID, o.Namespace); err != nil {
+		return err
+	}
+
+	sources := 0
+	if o.ChartPath != "" {
+		sources++
+	}
+	if o.ChartName != "" {
+		sources++
+	}
+	if sources != 1 {
+		return fmt.Errorf("必须且只能指定一个Chart来源: chart_path 或 chart_name")
+	}
+	if o.ChartRepo != "" && o.ChartName == "" {
+		return fmt.Errorf("chart_repo 需要与 chart_name 一起使用")
+	}
+	return validateLocalPath("chart_path", o.ChartPath)
+}
+
+// Validate 校验Kustomize部署选项
+func (o *KustomizeOptions) Validate() error {
+	if err := validateTarget(o.Name, o.ClusterID, o.Namespace); err != nil {
+		return err
+	}
+	if o.BasePath == "" {
+		return fmt.Errorf("base_path 不能为空")
+	}
+	if err := validateLocalPath("base_path", o.BasePath); err != nil {
+		return err
+	}
+	if err := validateLocalPath("overlay_path", o.OverlayPath); err != nil {
+		return err
+	}
+	if err := validateTimeout(o.Timeout); err != nil {
+		return err
+	}
+	return validateConflictPolicy(o.ConflictPolicy)
+}
+
+// validateTarget 校验部署名称、目标集群和命名空间
+func validateTarget(name, clusterID, namespace string) error {
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return fmt.Errorf("无效的名称 %q: %s", name, strings.Join(errs, "; "))
+	}
+	if clusterID == "" {
+		return fmt.Errorf("cluster_id 不能为空")
+	}
+	if namespace != "" {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return fmt.Errorf("无效的命名空间 %q: %s", namespace, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// validateLocalPath 校验请求中的路径为相对路径且不会通过..超出所在目录
+// 路径在交付包或工作目录内解析，不能指向服务器上的任意目录
+func validateLocalPath(field, path string) error {
+	if path != "" && !filepath.IsLocal(path) {
+		return fmt.Errorf("%s 必须为不超出所在目录的相对路径: %s", field, path)
+	}
+	return nil
+}
+
+// validateConflictPolicy 校验字段冲突策略
+func validateConflictPolicy(policy ConflictPolicy) error {
+	if !policy.Valid() {
+		return fmt.Errorf("无效的冲突策略 %q，可选值: force、fail、report", policy)
+	}
+	return nil
+}
+
+// validateTimeout 校验等待资源就绪的超时时间
+func validateTimeout(timeout int) error {
+	if timeout < 0 || timeout > maxWaitTimeout {
+		return fmt.Errorf("timeout 必须在0到%d秒之间", maxWaitTimeout)
+	}
+	return nil
+}
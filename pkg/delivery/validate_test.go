@@ -0,0 +1,95 @@
+package delivery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestYAMLOptionsValidate(t *testing.T) {
+	valid := func() *YAMLOptions {
+		return &YAMLOptions{Name: "app", ClusterID: "c1", Namespace: "default", Content: "apiVersion: v1\n"}
+	}
+	tests := []struct {
+		name    string
+		modify  func(o *YAMLOptions)
+		wantErr string
+	}{
+		{name: "valid", modify: func(o *YAMLOptions) {}},
+		{name: "default namespace", modify: func(o *YAMLOptions) { o.Namespace = "" }},
+		{name: "invalid name", modify: func(o *YAMLOptions) { o.Name = "My_App" }, wantErr: "无效的名称"},
+		{name: "missing cluster", modify: func(o *YAMLOptions) { o.ClusterID = "" }, wantErr: "cluster_id"},
+		{name: "invalid namespace", modify: func(o *YAMLOptions) { o.Namespace = "kube.system" }, wantErr: "无效的命名空间"},
+		{name: "blank content", modify: func(o *YAMLOptions) { o.Content = " \n" }, wantErr: "YAML内容不能为空"},
+		{name: "negative timeout", modify: func(o *YAMLOptions) { o.Timeout = -1 }, wantErr: "timeout"},
+		{name: "timeout too long", modify: func(o *YAMLOptions) { o.Timeout = maxWaitTimeout + 1 }, wantErr: "timeout"},
+		{name: "conflict policy", modify: func(o *YAMLOptions) { o.ConflictPolicy = ConflictReport }},
+		{name: "invalid conflict policy", modify: func(o *YAMLOptions) { o.ConflictPolicy = "skip" }, wantErr: "无效的冲突策略"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := valid()
+			tt.modify(options)
+			checkValidateError(t, options.Validate(), tt.wantErr)
+		})
+	}
+}
+
+func TestHelmOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options HelmOptions
+		wantErr string
+	}{
+		{name: "chart name", options: HelmOptions{Name: "app", ClusterID: "c1", ChartName: "nginx", ChartRepo: "https://charts.example.com"}},
+		{name: "chart path", options: HelmOptions{Name: "app", ClusterID: "c1", ChartPath: "charts/nginx"}},
+		{name: "no chart source", options: HelmOptions{Name: "app", ClusterID: "c1"}, wantErr: "Chart来源"},
+		{name: "both chart sources", options: HelmOptions{Name: "app", ClusterID: "c1", ChartName: "nginx", ChartPath: "charts/nginx"}, wantErr: "Chart来源"},
+		{name: "repo without chart name", options: HelmOptions{Name: "app", ClusterID: "c1", ChartPath: "charts/nginx", ChartRepo: "https://charts.example.com"}, wantErr: "chart_repo"},
+		{name: "absolute chart path", options: HelmOptions{Name: "app", ClusterID: "c1", ChartPath: "/etc"}, wantErr: "chart_path"},
+		{name: "chart path outside workdir", options: HelmOptions{Name: "app", ClusterID: "c1", ChartPath: "charts/../../etc"}, wantErr: "chart_path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidateError(t, tt.options.Validate(), tt.wantErr)
+		})
+	}
+}
+
+func TestKustomizeOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options KustomizeOptions
+		wantErr string
+	}{
+		{name: "base only", options: KustomizeOptions{Name: "app", ClusterID: "c1", BasePath: "base"}},
+		{name: "base and overlay", options: KustomizeOptions{Name: "app", ClusterID: "c1", BasePath: "base", OverlayPath: "overlays/prod"}},
+		{name: "missing base", options: KustomizeOptions{Name: "app", ClusterID: "c1"}, wantErr: "base_path"},
+		{name: "absolute base", options: KustomizeOptions{Name: "app", ClusterID: "c1", BasePath: "/srv/app"}, wantErr: "base_path"},
+		{name: "parent base", options: KustomizeOptions{Name: "app", ClusterID: "c1", BasePath: "../app"}, wantErr: "base_path"},
+		{name: "parent overlay", options: KustomizeOptions{Name: "app", ClusterID: "c1", BasePath: "base", OverlayPath: "overlays/../../prod"}, wantErr: "overlay_path"},
+		{name: "invalid timeout", options: KustomizeOptions{Name: "app", ClusterID: "c1", BasePath: "base", Timeout: -5}, wantErr: "timeout"},
+		{name: "invalid conflict policy", options: KustomizeOptions{Name: "app", ClusterID: "c1", BasePath: "base", ConflictPolicy: "merge"}, wantErr: "无效的冲突策略"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidateError(t, tt.options.Validate(), tt.wantErr)
+		})
+	}
+}
+
+// checkValidateError 校验错误为空或包含期望的内容
+func checkValidateError(t *testing.T, err error, want string) {
+	t.Helper()
+	if want == "" {
+		if err != nil {
+			t.Errorf("Validate() error = %v, want nil", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("Validate() error = %v, want containing %q", err, want)
+	}
+}
@@ -0,0 +1,243 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// pollInterval 轮询任务表的间隔，用于兜底唤醒
+const pollInterval = 5 * time.Second
+
+// workerPool 交付任务执行器
+// 等待中的任务保存在任务表中，按创建时间先进先出调度，重启后可继续执行
+type workerPool struct {
+	manager    *Manager
+	workers    int
+	perCluster int
+
+	mu       sync.Mutex
+	running  map[string]*runningTask
+	clusters map[string]int
+
+	wakeup chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// runningTask 运行中的任务
+type runningTask struct {
+	cancel context.CancelFunc
+	// done 任务结束并保存最终状态后关闭
+	done chan struct{}
+}
+
+// newWorkerPool 创建交付任务执行器
+func newWorkerPool(manager *Manager, workers, perCluster int) *workerPool {
+	if workers <= 0 {
+		workers = 1
+	}
+	if perCluster <= 0 || perCluster > workers {
+		perCluster = workers
+	}
+
+	return &workerPool{
+		manager:    manager,
+		workers:    workers,
+		perCluster: perCluster,
+		running:    make(map[string]*runningTask),
+		clusters:   make(map[string]int),
+		wakeup:     make(chan struct{}, 1),
+	}
+}
+
+// start 启动调度循环
+func (p *workerPool) start(ctx context.Context) error {
+	// 上次退出时仍在运行的任务重新排队
+	if err := p.manager.requeueRunningTasks(); err != nil {
+		return err
+	}
+
+	p.ctx, p.cancel = context.WithCancel(ctx)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			p.dispatch()
+
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-p.wakeup:
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return nil
+}
+
+// stop 停止调度并等待运行中的任务退出
+func (p *workerPool) stop() {
+	if p.cancel == nil {
+		return
+	}
+	p.cancel()
+	p.wg.Wait()
+}
+
+// notify 唤醒调度循环
+func (p *workerPool) notify() {
+	select {
+	case p.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch 从任务表中按顺序领取可执行的任务
+func (p *workerPool) dispatch() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.running) >= p.workers {
+		return
+	}
+
+	tasks, err := p.manager.listPendingTasks()
+	if err != nil {
+		fmt.Printf("查询等待中的交付任务失败: %v\n", err)
+		return
+	}
+
+	for _, task := range tasks {
+		if len(p.running) >= p.workers {
+			return
+		}
+		// 集群并发已满，跳过该集群的任务，不阻塞其他集群
+		if p.clusters[task.ClusterID] >= p.perCluster {
+			continue
+		}
+
+		claimed, err := p.manager.claimTask(task)
+		if err != nil {
+			fmt.Printf("任务 %s: %v\n", task.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		p.run(task)
+	}
+}
+
+// run 在独立的上下文中执行任务，调用方需持有锁
+func (p *workerPool) run(task *DeliveryTask) {
+	ctx, cancel := context.WithCancel(p.ctx)
+	running := &runningTask{cancel: cancel, done: make(chan struct{})}
+	p.running[task.ID] = running
+	p.clusters[task.ClusterID]++
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer p.release(task, running)
+		defer cancel()
+
+		logger := p.manager.taskLogger(task.ID)
+		logger.Infof(LogSourceTask, "开始执行%s交付任务 %s", task.Type, task.Name)
+
+		// 事件时间精确到秒，截断后同一秒内发生的事件不会被遗漏
+		started := time.Now().Truncate(time.Second)
+		execCtx, recorder := withAppliedRecorder(WithLogger(ctx, logger))
+		err := p.manager.execute(execCtx, task)
+
+		// 服务停止导致的中断保留运行中状态，重启后重新排队
+		if p.ctx.Err() != nil {
+			logger.Infof(LogSourceTask, "服务停止，任务将在重启后重新执行")
+			return
+		}
+
+		task.Errors = recorder.applyErrors()
+		task.Readiness = recorder.readinessReport()
+		task.Pruned = recorder.pruneResults()
+		status, message, done := StatusSuccess, "部署成功", "部署完成"
+		if task.RollbackOf > 0 {
+			status, message = StatusRolledBack, fmt.Sprintf("已回滚到修订版本 %d", task.RollbackOf)
+			done = fmt.Sprintf("回滚到修订版本 %d 完成", task.RollbackOf)
+		}
+		switch {
+		case ctx.Err() != nil:
+			status, message = StatusCancelled, "任务已取消"
+			logger.Infof(LogSourceTask, "%s", message)
+		case err != nil:
+			status, message = StatusFailed, err.Error()
+			logger.Errorf(LogSourceTask, "部署失败: %s", message)
+		case len(task.Errors) > 0:
+			message = fmt.Sprintf("%s，%d 个资源存在字段冲突未应用", done, len(task.Errors))
+			logger.Infof(LogSourceTask, "%s", message)
+		default:
+			logger.Infof(LogSourceTask, "%s", message)
+		}
+
+		if err := p.manager.updateTaskStatus(task, status, message); err != nil {
+			fmt.Printf("任务 %s: %v\n", task.ID, err)
+		}
+		// 取消的任务不生成修订版本
+		if status != StatusCancelled {
+			if err := p.manager.recordRevision(task, recorder.renderedManifests()); err != nil {
+				fmt.Printf("任务 %s: %v\n", task.ID, err)
+			}
+		}
+		p.manager.logs.finish(task.ID)
+		p.manager.RemoveBundle(task.BundleDir)
+
+		// 在后台收集已应用资源的事件，不占用执行槽位；取消的任务不再收集
+		if status != StatusCancelled {
+			p.wg.Add(1)
+			go func() {
+				defer p.wg.Done()
+				p.manager.collectEvents(p.ctx, task, started, recorder.list())
+			}()
+		}
+	}()
+}
+
+// release 释放任务占用的执行槽位，并通知等待任务结束的调用方
+func (p *workerPool) release(task *DeliveryTask, running *runningTask) {
+	p.mu.Lock()
+	delete(p.running, task.ID)
+	p.clusters[task.ClusterID]--
+	if p.clusters[task.ClusterID] <= 0 {
+		delete(p.clusters, task.ClusterID)
+	}
+	p.mu.Unlock()
+
+	close(running.done)
+	p.notify()
+}
+
+// cancelTask 取消任务：运行中的任务取消其上下文，并返回任务结束时关闭的通道；
+// 等待中的任务直接标记为已取消，返回的通道为nil
+// 与dispatch共用锁，保证任务不会在领取和取消之间丢失
+func (p *workerPool) cancelTask(id string) (<-chan struct{}, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if running, ok := p.running[id]; ok {
+		running.cancel()
+		return running.done, true, nil
+	}
+	cancelled, err := p.manager.cancelPendingTask(id)
+	if cancelled {
+		p.manager.logs.finish(id)
+	}
+	return nil, cancelled, err
+}
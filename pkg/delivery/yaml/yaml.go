@@ -3,185 +3,85 @@ package yaml
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
-	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/huyouba1/kde/pkg/delivery"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
-	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
+)
+
+// 确保Manager实现了delivery.Executor和delivery.Renderer
+var (
+	_ delivery.Executor = (*Manager)(nil)
+	_ delivery.Renderer = (*Manager)(nil)
 )
 
 // Manager YAML交付管理器
 type Manager struct {
-	workdir string
+	workdir     string
+	credentials *delivery.CredentialProvider
 }
 
 // NewManager 创建一个新的YAML交付管理器
-func NewManager(workdir string) *Manager {
+func NewManager(workdir string, credentials *delivery.CredentialProvider) *Manager {
 	return &Manager{
-		workdir: workdir,
+		workdir:     workdir,
+		credentials: credentials,
 	}
 }
 
-// Deploy 部署YAML资源
-func (m *Manager) Deploy(ctx context.Context, options *delivery.YAMLOptions) error {
-	// 创建工作目录
-	deployDir := filepath.Join(m.workdir, options.ClusterID, "yaml", options.Name)
-	if err := os.MkdirAll(deployDir, 0755); err != nil {
-		return fmt.Errorf("创建工作目录失败: %v", err)
+// Type 返回执行器处理的交付类型，实现delivery.Executor
+func (m *Manager) Type() delivery.DeliveryType {
+	return delivery.TypeYAML
+}
+
+// Execute 执行YAML交付任务，实现delivery.Executor
+func (m *Manager) Execute(ctx context.Context, task *delivery.DeliveryTask) error {
+	var options delivery.YAMLOptions
+	if err := delivery.DecodeOptions(task, &options); err != nil {
+		return err
 	}
+	return m.Deploy(ctx, &options)
+}
 
-	// 保存YAML内容到文件
-	yamlFile := filepath.Join(deployDir, "resources.yaml")
-	if err := ioutil.WriteFile(yamlFile, []byte(options.Content), 0644); err != nil {
-		return fmt.Errorf("保存YAML文件失败: %v", err)
+// Render 渲染任务的资源清单，实现delivery.Renderer
+func (m *Manager) Render(ctx context.Context, task *delivery.DeliveryTask) (*delivery.ManifestReader, error) {
+	var options delivery.YAMLOptions
+	if err := delivery.DecodeOptions(task, &options); err != nil {
+		return nil, err
 	}
+	return delivery.NewManifestReader(strings.NewReader(options.Content), manifestSource(&options)), nil
+}
 
+// Deploy 部署YAML资源，内容可能包含Secret，直接从内存应用而不写入工作目录
+func (m *Manager) Deploy(ctx context.Context, options *delivery.YAMLOptions) error {
 	// 获取Kubernetes客户端
-	clientset, dynamicClient, err := m.getKubernetesClient(options.ClusterID)
+	clientset, dynamicClient, _, err := m.credentials.Clients(options.ClusterID)
 	if err != nil {
 		return fmt.Errorf("获取Kubernetes客户端失败: %v", err)
 	}
 
 	// 应用YAML资源
-	if err := m.applyYAML(ctx, dynamicClient, options.Namespace, options.Content); err != nil {
+	applier := delivery.NewApplier(clientset, dynamicClient, options.Namespace, options.ConflictPolicy)
+	reader := delivery.NewManifestReader(strings.NewReader(options.Content), manifestSource(options))
+	if err := applier.Apply(ctx, reader); err != nil {
 		return fmt.Errorf("应用YAML资源失败: %v", err)
 	}
 
-	return nil
-}
-
-// getKubernetesClient 获取Kubernetes客户端
-func (m *Manager) getKubernetesClient(clusterID string) (*kubernetes.Clientset, dynamic.Interface, error) {
-	// TODO: 从存储中获取集群的kubeconfig
-	kubeconfig := ""
-
-	// 创建客户端配置
-	config, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfig))
-	if err != nil {
-		return nil, nil, fmt.Errorf("创建REST配置失败: %v", err)
-	}
-
-	// 创建clientset
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, nil, fmt.Errorf("创建clientset失败: %v", err)
-	}
-
-	// 创建dynamic客户端
-	dynamicClient, err := dynamic.NewForConfig(config)
-	if err != nil {
-		return nil, nil, fmt.Errorf("创建dynamic客户端失败: %v", err)
-	}
-
-	return clientset, dynamicClient, nil
-}
-
-// applyYAML 应用YAML资源
-func (m *Manager) applyYAML(ctx context.Context, dynamicClient dynamic.Interface, namespace, content string) error {
-	decoder := yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
-
-	// 分割多文档YAML
-	documents := splitYAMLDocuments(content)
-
-	for _, doc := range documents {
-		if len(doc) == 0 {
-			continue
-		}
-
-		// 解析YAML为非结构化对象
-		obj := &unstructured.Unstructured{}
-		_, gvk, err := decoder.Decode([]byte(doc), nil, obj)
-		if err != nil {
-			return fmt.Errorf("解析YAML文档失败: %v", err)
-		}
-
-		// 设置命名空间
-		if len(namespace) > 0 && obj.GetNamespace() == "" {
-			obj.SetNamespace(namespace)
-		}
-
-		// 获取资源的GVR
-		gvr := schema.GroupVersionResource{
-			Group:    gvk.Group,
-			Version:  gvk.Version,
-			Resource: pluralizeKind(gvk.Kind),
-		}
-
-		// 确定是否为命名空间级别的资源
-		var resourceClient dynamic.ResourceInterface
-		if obj.GetNamespace() != "" {
-			resourceClient = dynamicClient.Resource(gvr).Namespace(obj.GetNamespace())
-		} else {
-			resourceClient = dynamicClient.Resource(gvr)
-		}
-
-		// 检查资源是否存在
-		existing, err := resourceClient.Get(ctx, obj.GetName(), metav1.GetOptions{})
-		if err == nil {
-			// 资源存在，更新它
-			obj.SetResourceVersion(existing.GetResourceVersion())
-			_, err = resourceClient.Update(ctx, obj, metav1.UpdateOptions{})
-		} else {
-			// 资源不存在，创建它
-			_, err = resourceClient.Create(ctx, obj, metav1.CreateOptions{})
-		}
-
-		if err != nil {
-			return fmt.Errorf("应用资源 %s/%s 失败: %v", gvk.Kind, obj.GetName(), err)
+	// 等待资源就绪
+	if options.Wait {
+		if err := applier.WaitForReady(ctx, time.Duration(options.Timeout)*time.Second); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-// splitYAMLDocuments 分割多文档YAML
-func splitYAMLDocuments(content string) []string {
-	// TODO: 实现YAML文档分割
-	// 这里应该实现一个简单的YAML文档分割器
-	return []string{content}
-}
-
-// pluralizeKind 将Kind转换为复数形式的资源名称
-func pluralizeKind(kind string) string {
-	// 简单的复数规则
-	switch kind {
-	case "Endpoints":
-		return "endpoints"
-	case "ConfigMap":
-		return "configmaps"
-	case "Pod":
-		return "pods"
-	case "Service":
-		return "services"
-	case "Deployment":
-		return "deployments"
-	case "StatefulSet":
-		return "statefulsets"
-	case "DaemonSet":
-		return "daemonsets"
-	case "Ingress":
-		return "ingresses"
-	case "Secret":
-		return "secrets"
-	case "PersistentVolume":
-		return "persistentvolumes"
-	case "PersistentVolumeClaim":
-		return "persistentvolumeclaims"
-	case "Namespace":
-		return "namespaces"
-	default:
-		// 默认规则：添加s或es
-		if kind[len(kind)-1] == 's' || kind[len(kind)-1] == 'x' ||
-			(len(kind) > 1 && kind[len(kind)-2:] == "sh") ||
-			(len(kind) > 1 && kind[len(kind)-2:] == "ch") {
-			return kind + "es"
-		}
-		return kind + "s"
+// manifestSource 返回解析错误中使用的文件名
+func manifestSource(options *delivery.YAMLOptions) string {
+	if options.FilePath != "" {
+		return filepath.Base(options.FilePath)
 	}
+	return "content"
 }
@@ -0,0 +1,209 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultResyncPeriod 共享 informer 的默认重新同步周期
+const DefaultResyncPeriod = 10 * time.Minute
+
+// Cache 集群资源的共享 informer 缓存，包含节点、命名空间、工作负载、服务和事件
+type Cache struct {
+	factory   informers.SharedInformerFactory
+	synced    []cache.InformerSynced
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+	startedAt time.Time
+
+	mu          sync.RWMutex
+	lastEventAt time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// CacheStatus 缓存的同步状态
+type CacheStatus struct {
+	Synced    bool      `json:"synced"`
+	StartedAt time.Time `json:"started_at"`
+	// LastEventAt 最近一次收到资源变化或重新同步的时间
+	LastEventAt time.Time `json:"last_event_at"`
+	// StalenessSeconds 距离最近一次收到数据的秒数
+	StalenessSeconds float64 `json:"staleness_seconds"`
+	// LastError 最近一次 watch 失败的原因
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// newCache 创建并启动共享 informer 缓存
+func newCache(clientset kubernetes.Interface, resync time.Duration) *Cache {
+	if resync <= 0 {
+		resync = DefaultResyncPeriod
+	}
+
+	c := &Cache{
+		factory:   informers.NewSharedInformerFactory(clientset, resync),
+		stopCh:    make(chan struct{}),
+		startedAt: time.Now(),
+	}
+
+	sharedInformers := []cache.SharedIndexInformer{
+		c.factory.Core().V1().Nodes().Informer(),
+		c.factory.Core().V1().Namespaces().Informer(),
+		c.factory.Core().V1().Services().Informer(),
+		c.factory.Core().V1().Events().Informer(),
+		c.factory.Apps().V1().Deployments().Informer(),
+		c.factory.Apps().V1().StatefulSets().Informer(),
+		c.factory.Apps().V1().DaemonSets().Informer(),
+	}
+	for _, informer := range sharedInformers {
+		informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+			c.recordError(err)
+			cache.DefaultWatchErrorHandler(r, err)
+		})
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(interface{}) { c.recordEvent() },
+			UpdateFunc: func(interface{}, interface{}) { c.recordEvent() },
+			DeleteFunc: func(interface{}) { c.recordEvent() },
+		})
+		c.synced = append(c.synced, informer.HasSynced)
+	}
+
+	c.factory.Start(c.stopCh)
+	return c
+}
+
+// recordEvent 记录收到数据的时间
+func (c *Cache) recordEvent() {
+	c.mu.Lock()
+	c.lastEventAt = time.Now()
+	c.mu.Unlock()
+}
+
+// recordError 记录 watch 失败
+func (c *Cache) recordError(err error) {
+	c.mu.Lock()
+	c.lastError = err.Error()
+	c.lastErrorAt = time.Now()
+	c.mu.Unlock()
+}
+
+// waitForSync 等待所有 informer 完成首次同步
+func (c *Cache) waitForSync(ctx context.Context) error {
+	if !cache.WaitForCacheSync(ctx.Done(), c.synced...) {
+		return fmt.Errorf("timed out waiting for cache to sync: %w", ctx.Err())
+	}
+	return nil
+}
+
+// stop 停止所有 informer
+func (c *Cache) stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopCh)
+		c.factory.Shutdown()
+	})
+}
+
+// Status 返回缓存的同步状态和数据的陈旧程度
+func (c *Cache) Status() CacheStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	status := CacheStatus{
+		Synced:      true,
+		StartedAt:   c.startedAt,
+		LastEventAt: c.lastEventAt,
+		LastError:   c.lastError,
+	}
+	for _, synced := range c.synced {
+		if !synced() {
+			status.Synced = false
+		}
+	}
+
+	since := c.lastEventAt
+	if since.IsZero() {
+		since = c.startedAt
+	}
+	status.StalenessSeconds = time.Since(since).Seconds()
+
+	if !c.lastErrorAt.IsZero() {
+		errorAt := c.lastErrorAt
+		status.LastErrorAt = &errorAt
+	}
+	return status
+}
+
+// Nodes 返回节点 lister
+func (c *Cache) Nodes() corelisters.NodeLister {
+	return c.factory.Core().V1().Nodes().Lister()
+}
+
+// Namespaces 返回命名空间 lister
+func (c *Cache) Namespaces() corelisters.NamespaceLister {
+	return c.factory.Core().V1().Namespaces().Lister()
+}
+
+// Services 返回服务 lister
+func (c *Cache) Services() corelisters.ServiceLister {
+	return c.factory.Core().V1().Services().Lister()
+}
+
+// Events 返回事件 lister
+func (c *Cache) Events() corelisters.EventLister {
+	return c.factory.Core().V1().Events().Lister()
+}
+
+// Deployments 返回 Deployment lister
+func (c *Cache) Deployments() appslisters.DeploymentLister {
+	return c.factory.Apps().V1().Deployments().Lister()
+}
+
+// StatefulSets 返回 StatefulSet lister
+func (c *Cache) StatefulSets() appslisters.StatefulSetLister {
+	return c.factory.Apps().V1().StatefulSets().Lister()
+}
+
+// DaemonSets 返回 DaemonSet lister
+func (c *Cache) DaemonSets() appslisters.DaemonSetLister {
+	return c.factory.Apps().V1().DaemonSets().Lister()
+}
+
+// Cache 返回集群的共享 informer 缓存，首次调用时启动并等待同步完成
+func (c *Client) Cache(ctx context.Context) (*Cache, error) {
+	c.cacheMu.Lock()
+	if c.closed {
+		c.cacheMu.Unlock()
+		return nil, fmt.Errorf("client is closed")
+	}
+	if c.cache == nil {
+		c.cache = newCache(c.clientset, c.resyncPeriod)
+	}
+	informerCache := c.cache
+	c.cacheMu.Unlock()
+
+	if err := informerCache.waitForSync(ctx); err != nil {
+		return nil, err
+	}
+	return informerCache, nil
+}
+
+// Close 停止客户端的共享 informer 缓存，关闭后不能再使用缓存
+func (c *Client) Close() {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	c.closed = true
+	if c.cache != nil {
+		c.cache.stop()
+		c.cache = nil
+	}
+}
@@ -2,20 +2,46 @@ package k8s
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/tools/remotecommand"
 )
 
 // Client 封装了 Kubernetes 客户端
 type Client struct {
-	clientset *kubernetes.Clientset
-	config    *rest.Config
+	clientset     *kubernetes.Clientset
+	dynamicClient dynamic.Interface
+	config        *rest.Config
+
+	// resyncPeriod 共享 informer 的重新同步周期
+	resyncPeriod time.Duration
+	cacheMu      sync.Mutex
+	cache        *Cache
+	closed       bool
+
+	mapperOnce sync.Once
+	mapper     meta.ResettableRESTMapper
 }
 
 // NewClient 创建一个新的 Kubernetes 客户端
@@ -46,15 +72,113 @@ func NewClient(kubeconfigPath string) (*Client, error) {
 		}
 	}
 
+	return newClientForConfig(config)
+}
+
+// Options 从 kubeconfig 内容创建客户端时的可选配置，零值表示使用 kubeconfig 或 client-go 的默认值
+type Options struct {
+	// Context 使用的上下文，为空时使用 kubeconfig 的 current-context
+	Context string
+	// ImpersonateUser 以指定用户身份访问集群
+	ImpersonateUser string
+	// ImpersonateGroups 以指定用户组身份访问集群
+	ImpersonateGroups []string
+	// QPS 客户端请求速率限制
+	QPS float32
+	// Burst 客户端请求突发上限
+	Burst int
+	// Timeout 单个请求的超时时间，会中断 watch 和日志流等长连接
+	Timeout time.Duration
+	// DialTimeout 建立连接的超时时间
+	DialTimeout time.Duration
+	// ProxyURL 访问 API Server 使用的代理
+	ProxyURL string
+	// ResyncPeriod 共享 informer 的重新同步周期
+	ResyncPeriod time.Duration
+}
+
+// NewClientFromKubeconfig 使用 kubeconfig 内容创建 Kubernetes 客户端，不读写任何文件
+func NewClientFromKubeconfig(kubeconfig []byte, opts *Options) (*Client, error) {
+	config, err := RESTConfigFromKubeconfig(kubeconfig, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if opts != nil && opts.ResyncPeriod > 0 {
+		client.resyncPeriod = opts.ResyncPeriod
+	}
+	return client, nil
+}
+
+// RESTConfigFromKubeconfig 使用 kubeconfig 内容构建 rest.Config
+func RESTConfigFromKubeconfig(kubeconfig []byte, opts *Options) (*rest.Config, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	apiConfig, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig: %w", err)
+	}
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: opts.Context,
+		AuthInfo: clientcmdapi.AuthInfo{
+			Impersonate:       opts.ImpersonateUser,
+			ImpersonateGroups: opts.ImpersonateGroups,
+		},
+		ClusterInfo: clientcmdapi.Cluster{
+			ProxyURL: opts.ProxyURL,
+		},
+	}
+
+	config, err := clientcmd.NewNonInteractiveClientConfig(*apiConfig, opts.Context, overrides, nil).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build config from kubeconfig: %w", err)
+	}
+
+	if opts.QPS > 0 {
+		config.QPS = opts.QPS
+	}
+	if opts.Burst > 0 {
+		config.Burst = opts.Burst
+	}
+	if opts.Timeout > 0 {
+		config.Timeout = opts.Timeout
+	}
+	if opts.DialTimeout > 0 {
+		config.Dial = (&net.Dialer{
+			Timeout:   opts.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+
+	return config, nil
+}
+
+// newClientForConfig 使用 rest.Config 创建 clientset 和 dynamic 客户端
+func newClientForConfig(config *rest.Config) (*Client, error) {
 	// 创建 clientset
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create clientset: %w", err)
 	}
 
+	// 创建 dynamic 客户端
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
 	return &Client{
-		clientset: clientset,
-		config:    config,
+		clientset:     clientset,
+		dynamicClient: dynamicClient,
+		config:        config,
+		resyncPeriod:  DefaultResyncPeriod,
 	}, nil
 }
 
@@ -63,11 +187,55 @@ func (c *Client) GetClientSet() *kubernetes.Clientset {
 	return c.clientset
 }
 
+// GetDynamicClient 返回 Kubernetes dynamic 客户端
+func (c *Client) GetDynamicClient() dynamic.Interface {
+	return c.dynamicClient
+}
+
 // GetConfig 返回 Kubernetes 配置
 func (c *Client) GetConfig() *rest.Config {
 	return c.config
 }
 
+// Kubeconfig 将客户端配置序列化为只包含当前集群和用户的 kubeconfig
+func (c *Client) Kubeconfig() ([]byte, error) {
+	const name = "kde"
+
+	kubeconfig := clientcmdapi.NewConfig()
+	kubeconfig.Clusters[name] = &clientcmdapi.Cluster{
+		Server:                   c.config.Host,
+		TLSServerName:            c.config.ServerName,
+		InsecureSkipTLSVerify:    c.config.Insecure,
+		CertificateAuthority:     c.config.CAFile,
+		CertificateAuthorityData: c.config.CAData,
+	}
+	kubeconfig.AuthInfos[name] = &clientcmdapi.AuthInfo{
+		ClientCertificate:     c.config.CertFile,
+		ClientCertificateData: c.config.CertData,
+		ClientKey:             c.config.KeyFile,
+		ClientKeyData:         c.config.KeyData,
+		Token:                 c.config.BearerToken,
+		TokenFile:             c.config.BearerTokenFile,
+		Impersonate:           c.config.Impersonate.UserName,
+		ImpersonateGroups:     c.config.Impersonate.Groups,
+		Username:              c.config.Username,
+		Password:              c.config.Password,
+		AuthProvider:          c.config.AuthProvider,
+		Exec:                  c.config.ExecProvider,
+	}
+	kubeconfig.Contexts[name] = &clientcmdapi.Context{
+		Cluster:  name,
+		AuthInfo: name,
+	}
+	kubeconfig.CurrentContext = name
+
+	data, err := clientcmd.Write(*kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize kubeconfig: %w", err)
+	}
+	return data, nil
+}
+
 // TestConnection 测试与 Kubernetes 集群的连接
 func (c *Client) TestConnection(ctx context.Context) error {
 	_, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
@@ -101,9 +269,134 @@ func (c *Client) GetClusterInfo(ctx context.Context) (*ClusterInfo, error) {
 	}, nil
 }
 
+// ListNodes 获取集群中的所有节点
+func (c *Client) ListNodes(ctx context.Context) ([]corev1.Node, error) {
+	nodes, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	return nodes.Items, nil
+}
+
+// StreamPodLogs 打开 Pod 日志流，调用方负责关闭
+func (c *Client) StreamPodLogs(ctx context.Context, namespace, pod string, opts *corev1.PodLogOptions) (io.ReadCloser, error) {
+	stream, err := c.clientset.CoreV1().Pods(namespace).GetLogs(pod, opts).Stream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stream logs of pod %s/%s: %w", namespace, pod, err)
+	}
+	return stream, nil
+}
+
+// ExecInPod 在 Pod 的容器中执行命令，直到命令结束或上下文取消
+func (c *Client) ExecInPod(ctx context.Context, namespace, pod string, opts *corev1.PodExecOptions, streams remotecommand.StreamOptions) error {
+	req := c.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(opts, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(c.config, http.MethodPost, req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create executor: %w", err)
+	}
+	return executor.StreamWithContext(ctx, streams)
+}
+
+// CheckHealth 检查 /readyz、服务端版本和节点就绪状态
+// 无法连接 API Server 时返回错误；能连接但集群不健康时在 Problems 中说明原因
+func (c *Client) CheckHealth(ctx context.Context) (*HealthStatus, error) {
+	health := &HealthStatus{}
+
+	if _, err := c.clientset.Discovery().RESTClient().Get().AbsPath("/readyz").DoRaw(ctx); err != nil {
+		var status apierrors.APIStatus
+		if !errors.As(err, &status) {
+			return nil, fmt.Errorf("failed to check readyz: %w", err)
+		}
+		health.Problems = append(health.Problems, fmt.Sprintf("readyz: %v", err))
+	}
+
+	version, err := c.clientset.Discovery().ServerVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server version: %w", err)
+	}
+	health.Version = version.String()
+
+	nodes, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	health.NodeCount = len(nodes.Items)
+	for _, node := range nodes.Items {
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == corev1.NodeReady && condition.Status == corev1.ConditionTrue {
+				health.ReadyNodes++
+			}
+		}
+	}
+	if health.ReadyNodes == 0 {
+		health.Problems = append(health.Problems, "no ready nodes")
+	}
+
+	namespaces, err := c.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	health.NamespaceCount = len(namespaces.Items)
+
+	return health, nil
+}
+
+// HealthStatus 集群健康检查结果
+type HealthStatus struct {
+	Version        string
+	NodeCount      int
+	ReadyNodes     int
+	NamespaceCount int
+	// Problems 集群可以连接但不健康的原因
+	Problems []string
+}
+
+// Healthy 集群是否健康
+func (h *HealthStatus) Healthy() bool {
+	return len(h.Problems) == 0
+}
+
 // ClusterInfo 包含集群的基本信息
 type ClusterInfo struct {
 	Version        string
 	NodeCount      int
 	NamespaceCount int
 }
+
+// RESTMapper 返回基于服务端发现的 RESTMapper，发现结果在客户端内缓存
+func (c *Client) RESTMapper() meta.ResettableRESTMapper {
+	c.mapperOnce.Do(func() {
+		c.mapper = restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(c.clientset.Discovery()))
+	})
+	return c.mapper
+}
+
+// ResolveResource 将 GroupVersionResource 解析为 RESTMapping，发现缓存过期时刷新一次后重试
+func (c *Client) ResolveResource(gvr schema.GroupVersionResource) (*meta.RESTMapping, error) {
+	mapper := c.RESTMapper()
+
+	mapping, err := resolveResource(mapper, gvr)
+	if meta.IsNoMatchError(err) {
+		mapper.Reset()
+		mapping, err = resolveResource(mapper, gvr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve resource %s: %w", gvr.String(), err)
+	}
+	return mapping, nil
+}
+
+// resolveResource 通过资源查找类型，再获取类型的 RESTMapping
+func resolveResource(mapper meta.RESTMapper, gvr schema.GroupVersionResource) (*meta.RESTMapping, error) {
+	gvk, err := mapper.KindFor(gvr)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
@@ -1,17 +1,28 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"time"
 
+	"github.com/huyouba1/kde/pkg/delivery"
 	"github.com/huyouba1/kde/pkg/plugin"
 )
 
+// Rollbacker 回滚应用的交付管理器，由宿主程序通过SetRollbacker注入，*delivery.Manager实现了该接口
+type Rollbacker interface {
+	Rollback(ctx context.Context, applicationID string, revision int) (*delivery.DeliveryTask, error)
+}
+
+// 确保delivery.Manager实现了Rollbacker
+var _ Rollbacker = (*delivery.Manager)(nil)
+
 // DeliveryManagerPlugin 应用交付管理插件实现
 type DeliveryManagerPlugin struct {
-	info    plugin.PluginInfo
-	running bool
-	config  DeliveryConfig
+	info       plugin.PluginInfo
+	running    bool
+	config     DeliveryConfig
+	rollbacker Rollbacker
 }
 
 // DeliveryConfig 交付配置
@@ -119,16 +130,23 @@ func (p *DeliveryManagerPlugin) GetDeploymentStatus(deployID string) (Deployment
 	return StatusSuccess, nil
 }
 
-// RollbackDeployment 回滚部署
-func (p *DeliveryManagerPlugin) RollbackDeployment(deployID string) error {
-	fmt.Printf("回滚部署 %s\n", deployID)
-
-	// TODO: 实现部署回滚逻辑
-	// 1. 获取部署信息
-	// 2. 执行回滚操作
-	// 3. 更新部署状态
+// SetRollbacker 注入用于回滚应用的交付管理器
+func (p *DeliveryManagerPlugin) SetRollbacker(rollbacker Rollbacker) {
+	p.rollbacker = rollbacker
+}
 
-	return nil
+// RollbackDeployment 将应用回滚到指定的修订版本，返回执行回滚的交付任务ID
+func (p *DeliveryManagerPlugin) RollbackDeployment(applicationID string, revision int) (string, error) {
+	if p.rollbacker == nil {
+		return "", fmt.Errorf("交付管理器未注入，无法回滚应用 %s", applicationID)
+	}
+
+	task, err := p.rollbacker.Rollback(context.Background(), applicationID, revision)
+	if err != nil {
+		return "", fmt.Errorf("回滚应用 %s 到修订版本 %d 失败: %v", applicationID, revision, err)
+	}
+	fmt.Printf("回滚应用 %s 到修订版本 %d，任务 %s\n", applicationID, revision, task.ID)
+	return task.ID, nil
 }
 
 // SetHealthCheck 设置健康检查
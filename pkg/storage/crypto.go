@@ -0,0 +1,464 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huyouba1/kde/configs"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// keySize 主密钥和数据密钥的长度（AES-256）
+	keySize = 32
+	// encryptedPrefix 加密字段的前缀，格式为 enc:v<密钥版本>:<加密的数据密钥>:<加密的数据>
+	encryptedPrefix = "enc:v"
+	// encryptedSerializer 加密字段使用的gorm序列化器名称
+	encryptedSerializer = "encrypted"
+	// keyFileCheckInterval 检查主密钥文件是否被rotate-key修改的间隔
+	keyFileCheckInterval = 30 * time.Second
+)
+
+var (
+	// ErrKeyringNotLoaded 未加载主密钥
+	ErrKeyringNotLoaded = errors.New("未加载主密钥")
+	// errUnknownKeyVersion 密文使用的主密钥版本未加载
+	errUnknownKeyVersion = errors.New("缺少主密钥版本")
+)
+
+var (
+	keyringMu sync.RWMutex
+	keyring   *Keyring
+	// keyFileChecked 上次检查主密钥文件的时间
+	keyFileChecked time.Time
+)
+
+func init() {
+	// 模型字段通过 gorm:"serializer:encrypted" 启用加密
+	schema.RegisterSerializer(encryptedSerializer, EncryptedSerializer{})
+}
+
+// Keyring 按版本保存的主密钥，使用最新版本加密，按密文中记录的版本解密
+type Keyring struct {
+	keys    map[int][]byte
+	current int
+	// fromEnv 主密钥来自环境变量，轮换时不能写回
+	fromEnv bool
+	// path 主密钥文件路径，modTime 加载时文件的修改时间，用于发现rotate-key追加的新版本
+	path    string
+	modTime time.Time
+}
+
+// SetKeyring 设置加密字段使用的主密钥
+func SetKeyring(k *Keyring) {
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+	keyring = k
+}
+
+// currentKeyring 获取加密字段使用的主密钥
+func currentKeyring() *Keyring {
+	keyringMu.RLock()
+	defer keyringMu.RUnlock()
+	return keyring
+}
+
+// reloadKeyring 主密钥文件在加载后被修改时重新加载，使运行中的服务读取rotate-key写入的新版本数据，
+// 并在之后使用新版本加密；force为false时最多每keyFileCheckInterval检查一次文件
+// 主密钥来自环境变量时无法重新加载，轮换后需要重启服务
+func reloadKeyring(force bool) *Keyring {
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+
+	if keyring == nil || keyring.path == "" {
+		return keyring
+	}
+	if !force && time.Since(keyFileChecked) < keyFileCheckInterval {
+		return keyring
+	}
+	keyFileChecked = time.Now()
+
+	info, err := os.Stat(keyring.path)
+	if err != nil || info.ModTime().Equal(keyring.modTime) {
+		return keyring
+	}
+	data, err := os.ReadFile(keyring.path)
+	if err != nil {
+		fmt.Printf("重新加载主密钥文件失败: %v\n", err)
+		return keyring
+	}
+	k, err := parseKeyring(string(data))
+	if err != nil {
+		fmt.Printf("重新加载主密钥文件 %s 失败: %v\n", keyring.path, err)
+		return keyring
+	}
+	k.path, k.modTime = keyring.path, info.ModTime()
+	keyring = k
+	return keyring
+}
+
+// LoadKeyring 加载主密钥
+// 优先读取环境变量，其次读取密钥文件；两者都不存在时生成新的密钥文件
+func LoadKeyring(cfg configs.EncryptionConfig) (*Keyring, error) {
+	if cfg.KeyEnv != "" {
+		if value := os.Getenv(cfg.KeyEnv); value != "" {
+			k, err := parseKeyring(value)
+			if err != nil {
+				return nil, fmt.Errorf("解析环境变量 %s 中的主密钥失败: %v", cfg.KeyEnv, err)
+			}
+			k.fromEnv = true
+			return k, nil
+		}
+	}
+
+	if cfg.KeyFile == "" {
+		return nil, fmt.Errorf("未配置主密钥文件或环境变量")
+	}
+
+	data, err := os.ReadFile(cfg.KeyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, err := AddKeyVersion(cfg.KeyFile); err != nil {
+			return nil, err
+		}
+		data, err = os.ReadFile(cfg.KeyFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取主密钥文件失败: %v", err)
+	}
+
+	k, err := parseKeyring(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("解析主密钥文件 %s 失败: %v", cfg.KeyFile, err)
+	}
+	k.path = cfg.KeyFile
+	if info, err := os.Stat(cfg.KeyFile); err == nil {
+		k.modTime = info.ModTime()
+	}
+	return k, nil
+}
+
+// parseKeyring 解析主密钥，每行（或逗号分隔的每项）格式为 <版本>:<base64编码的32字节密钥>
+func parseKeyring(content string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[int][]byte)}
+
+	entries := strings.FieldsFunc(content, func(r rune) bool {
+		return r == '\n' || r == ','
+	})
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		versionText, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("密钥格式错误，应为 <版本>:<密钥>")
+		}
+		version, err := strconv.Atoi(strings.TrimSpace(versionText))
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("无效的密钥版本: %s", versionText)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("密钥版本 %d 不是有效的base64: %v", version, err)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("密钥版本 %d 长度必须为 %d 字节", version, keySize)
+		}
+		if _, exists := k.keys[version]; exists {
+			return nil, fmt.Errorf("密钥版本 %d 重复", version)
+		}
+
+		k.keys[version] = key
+		if version > k.current {
+			k.current = version
+		}
+	}
+
+	if len(k.keys) == 0 {
+		return nil, fmt.Errorf("没有可用的主密钥")
+	}
+	return k, nil
+}
+
+// AddKeyVersion 生成新版本的主密钥并追加到密钥文件，文件不存在时创建，返回新版本号
+func AddKeyVersion(path string) (int, error) {
+	version := 1
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		k, err := parseKeyring(string(data))
+		if err != nil {
+			return 0, fmt.Errorf("解析主密钥文件 %s 失败: %v", path, err)
+		}
+		version = k.current + 1
+	case !errors.Is(err, os.ErrNotExist):
+		return 0, fmt.Errorf("读取主密钥文件失败: %v", err)
+	}
+
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return 0, fmt.Errorf("生成主密钥失败: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return 0, fmt.Errorf("创建主密钥目录失败: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("打开主密钥文件失败: %v", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	fmt.Fprintf(writer, "%d:%s\n", version, base64.StdEncoding.EncodeToString(key))
+	if err := writer.Flush(); err != nil {
+		return 0, fmt.Errorf("写入主密钥文件失败: %v", err)
+	}
+
+	return version, nil
+}
+
+// CurrentVersion 返回用于加密的主密钥版本
+func (k *Keyring) CurrentVersion() int {
+	return k.current
+}
+
+// FromEnv 主密钥是否来自环境变量
+func (k *Keyring) FromEnv() bool {
+	return k.fromEnv
+}
+
+// Versions 返回所有主密钥版本
+func (k *Keyring) Versions() []int {
+	versions := make([]int, 0, len(k.keys))
+	for version := range k.keys {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// Encrypt 信封加密：使用随机数据密钥加密内容，再用当前主密钥加密数据密钥
+func (k *Keyring) Encrypt(plaintext []byte) (string, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", fmt.Errorf("生成数据密钥失败: %v", err)
+	}
+
+	wrappedKey, err := seal(k.keys[k.current], dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dataKey, plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s%d:%s:%s", encryptedPrefix, k.current,
+		base64.StdEncoding.EncodeToString(wrappedKey),
+		base64.StdEncoding.EncodeToString(ciphertext)), nil
+}
+
+// Decrypt 解密Encrypt生成的内容
+func (k *Keyring) Decrypt(value string) ([]byte, error) {
+	version, wrappedKey, ciphertext, err := parseEncrypted(value)
+	if err != nil {
+		return nil, err
+	}
+
+	masterKey, ok := k.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("%w %d", errUnknownKeyVersion, version)
+	}
+	dataKey, err := open(masterKey, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("解密数据密钥失败: %v", err)
+	}
+	plaintext, err := open(dataKey, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("解密数据失败: %v", err)
+	}
+	return plaintext, nil
+}
+
+// IsEncrypted 判断字段值是否已加密
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// parseEncrypted 解析加密字段，返回主密钥版本、加密的数据密钥和加密的数据
+func parseEncrypted(value string) (int, []byte, []byte, error) {
+	parts := strings.SplitN(strings.TrimPrefix(value, encryptedPrefix), ":", 3)
+	if len(parts) != 3 {
+		return 0, nil, nil, fmt.Errorf("加密数据格式错误")
+	}
+
+	version, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("无效的密钥版本: %s", parts[0])
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("加密数据格式错误: %v", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("加密数据格式错误: %v", err)
+	}
+	return version, wrappedKey, ciphertext, nil
+}
+
+// seal 使用AES-GCM加密，随机nonce放在密文之前
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("生成nonce失败: %v", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open 解密seal生成的密文
+func open(key, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("密文长度不足")
+	}
+	nonce, data := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, data, nil)
+}
+
+// newGCM 创建AES-GCM
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("创建AES加密器失败: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("创建AES-GCM失败: %v", err)
+	}
+	return gcm, nil
+}
+
+// EncryptedSerializer 加密字符串字段的gorm序列化器
+// 读取时兼容未加密的历史数据，写入时总是使用当前主密钥加密
+type EncryptedSerializer struct{}
+
+// Scan 解密数据库中的值，实现schema.SerializerInterface
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		return fmt.Errorf("加密字段 %s 的类型不支持: %T", field.Name, dbValue)
+	}
+
+	if IsEncrypted(value) {
+		k := currentKeyring()
+		if k == nil {
+			return ErrKeyringNotLoaded
+		}
+		plaintext, err := k.Decrypt(value)
+		if errors.Is(err, errUnknownKeyVersion) {
+			// 其他进程轮换了主密钥，重新加载密钥文件后重试
+			plaintext, err = reloadKeyring(true).Decrypt(value)
+		}
+		if err != nil {
+			return fmt.Errorf("解密字段 %s 失败: %v", field.Name, err)
+		}
+		value = string(plaintext)
+	}
+
+	return field.Set(ctx, dst, value)
+}
+
+// Value 加密写入数据库的值，实现schema.SerializerInterface
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("加密字段 %s 必须为字符串", field.Name)
+	}
+	if value == "" {
+		return "", nil
+	}
+
+	k := reloadKeyring(false)
+	if k == nil {
+		return nil, ErrKeyringNotLoaded
+	}
+	return k.Encrypt([]byte(value))
+}
+
+// Reencrypt 使用当前主密钥重新加密模型中的所有加密字段，包括已软删除的记录，返回处理的记录数
+func (f *Factory) Reencrypt(models ...interface{}) (int64, error) {
+	var total int64
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: f.db}
+		if err := stmt.Parse(model); err != nil {
+			return total, fmt.Errorf("解析模型失败: %v", err)
+		}
+
+		columns := encryptedColumns(stmt.Schema)
+		if len(columns) == 0 {
+			continue
+		}
+
+		rows := reflect.New(reflect.SliceOf(reflect.TypeOf(model)))
+		result := f.db.Unscoped().Model(model).FindInBatches(rows.Interface(), 100, func(tx *gorm.DB, batch int) error {
+			records := rows.Elem()
+			for i := 0; i < records.Len(); i++ {
+				// 读取时已解密，保存时使用当前主密钥重新加密
+				if err := f.db.Unscoped().Select(columns).Save(records.Index(i).Interface()).Error; err != nil {
+					return err
+				}
+			}
+			total += int64(records.Len())
+			return nil
+		})
+		if result.Error != nil {
+			return total, fmt.Errorf("重新加密 %s 失败: %v", stmt.Schema.Table, result.Error)
+		}
+	}
+	return total, nil
+}
+
+// encryptedColumns 返回模型中使用加密序列化器的列
+func encryptedColumns(s *schema.Schema) []string {
+	columns := make([]string, 0)
+	for _, field := range s.Fields {
+		if field.TagSettings["SERIALIZER"] == encryptedSerializer && field.DBName != "" {
+			columns = append(columns, field.DBName)
+		}
+	}
+	return columns
+}
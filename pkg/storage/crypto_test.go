@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huyouba1/kde/configs"
+)
+
+// testKey 返回base64编码的测试主密钥，每个字节均为b
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, keySize))
+}
+
+func TestParseKeyring(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		wantVersions []int
+		wantCurrent  int
+		wantErr      bool
+	}{
+		{name: "single version", content: "1:" + testKey(1), wantVersions: []int{1}, wantCurrent: 1},
+		{
+			name:         "lines with comments",
+			content:      "# master keys\n1:" + testKey(1) + "\n\n3:" + testKey(3) + "\n2:" + testKey(2) + "\n",
+			wantVersions: []int{1, 2, 3},
+			wantCurrent:  3,
+		},
+		{name: "comma separated", content: "1:" + testKey(1) + ", 2:" + testKey(2), wantVersions: []int{1, 2}, wantCurrent: 2},
+		{name: "empty", content: "# nothing\n", wantErr: true},
+		{name: "missing version", content: testKey(1), wantErr: true},
+		{name: "invalid version", content: "0:" + testKey(1), wantErr: true},
+		{name: "invalid base64", content: "1:not-base64!", wantErr: true},
+		{name: "short key", content: "1:" + base64.StdEncoding.EncodeToString([]byte("short")), wantErr: true},
+		{name: "duplicate version", content: "1:" + testKey(1) + "\n1:" + testKey(2), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := parseKeyring(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseKeyring() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(k.Versions(), tt.wantVersions) || k.CurrentVersion() != tt.wantCurrent {
+				t.Errorf("parseKeyring() versions = %v current = %d, want %v current = %d",
+					k.Versions(), k.CurrentVersion(), tt.wantVersions, tt.wantCurrent)
+			}
+		})
+	}
+}
+
+func TestKeyringEncryptDecrypt(t *testing.T) {
+	old, err := parseKeyring("1:" + testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := parseKeyring("1:" + testKey(1) + "\n2:" + testKey(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := parseKeyring("1:" + testKey(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := old.Encrypt([]byte("kubeconfig"))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if !IsEncrypted(encrypted) || !strings.HasPrefix(encrypted, "enc:v1:") {
+		t.Fatalf("Encrypt() = %q, want enc:v1: prefix", encrypted)
+	}
+	again, _ := old.Encrypt([]byte("kubeconfig"))
+	if again == encrypted {
+		t.Error("Encrypt() is deterministic, want random data key and nonce")
+	}
+	newer, err := rotated.Encrypt([]byte("kubeconfig"))
+	if err != nil || !strings.HasPrefix(newer, "enc:v2:") {
+		t.Fatalf("Encrypt() with rotated keyring = %q, %v, want enc:v2: prefix", newer, err)
+	}
+
+	parts := strings.Split(encrypted, ":")
+	tampered := []byte(parts[3])
+	tampered[len(tampered)-3] ^= 'A' ^ 'B'
+
+	tests := []struct {
+		name    string
+		keyring *Keyring
+		value   string
+		want    string
+		wantErr error
+	}{
+		{name: "same keyring", keyring: old, value: encrypted, want: "kubeconfig"},
+		{name: "old version after rotation", keyring: rotated, value: encrypted, want: "kubeconfig"},
+		{name: "new version", keyring: rotated, value: newer, want: "kubeconfig"},
+		{name: "unknown version", keyring: old, value: newer, wantErr: errUnknownKeyVersion},
+		{name: "wrong key", keyring: other, value: encrypted},
+		{name: "tampered ciphertext", keyring: old, value: strings.Join(append(parts[:3:3], string(tampered)), ":")},
+		{name: "malformed", keyring: old, value: "enc:v1:abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.keyring.Decrypt(tt.value)
+			if tt.want != "" {
+				if err != nil || string(got) != tt.want {
+					t.Errorf("Decrypt() = %q, %v, want %q", got, err, tt.want)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Decrypt() = %q, want error", got)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Decrypt() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAddKeyVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "master.key")
+
+	for want := 1; want <= 3; want++ {
+		version, err := AddKeyVersion(path)
+		if err != nil {
+			t.Fatalf("AddKeyVersion() error = %v", err)
+		}
+		if version != want {
+			t.Errorf("AddKeyVersion() = %d, want %d", version, want)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("key file mode = %o, want 600", perm)
+	}
+
+	data, _ := os.ReadFile(path)
+	k, err := parseKeyring(string(data))
+	if err != nil {
+		t.Fatalf("parseKeyring() error = %v", err)
+	}
+	if !reflect.DeepEqual(k.Versions(), []int{1, 2, 3}) {
+		t.Errorf("versions = %v, want [1 2 3]", k.Versions())
+	}
+
+	if err := os.WriteFile(path, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddKeyVersion(path); err == nil {
+		t.Error("AddKeyVersion() error = nil for invalid key file")
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	dir := t.TempDir()
+	envKey := "KDE_TEST_MASTER_KEY"
+
+	t.Run("environment before file", func(t *testing.T) {
+		t.Setenv(envKey, "5:"+testKey(5))
+		k, err := LoadKeyring(configs.EncryptionConfig{KeyFile: filepath.Join(dir, "unused.key"), KeyEnv: envKey})
+		if err != nil {
+			t.Fatalf("LoadKeyring() error = %v", err)
+		}
+		if !k.FromEnv() || k.CurrentVersion() != 5 {
+			t.Errorf("LoadKeyring() fromEnv = %v current = %d, want environment key 5", k.FromEnv(), k.CurrentVersion())
+		}
+		if _, err := os.Stat(filepath.Join(dir, "unused.key")); !os.IsNotExist(err) {
+			t.Error("LoadKeyring() created the key file although the environment variable is set")
+		}
+	})
+
+	t.Run("generate missing file", func(t *testing.T) {
+		k, err := LoadKeyring(configs.EncryptionConfig{KeyFile: filepath.Join(dir, "master.key"), KeyEnv: envKey})
+		if err != nil {
+			t.Fatalf("LoadKeyring() error = %v", err)
+		}
+		if k.FromEnv() || k.CurrentVersion() != 1 {
+			t.Errorf("LoadKeyring() fromEnv = %v current = %d, want generated file key 1", k.FromEnv(), k.CurrentVersion())
+		}
+	})
+
+	t.Run("invalid environment key", func(t *testing.T) {
+		t.Setenv(envKey, "invalid")
+		if _, err := LoadKeyring(configs.EncryptionConfig{KeyEnv: envKey}); err == nil {
+			t.Error("LoadKeyring() error = nil for invalid environment key")
+		}
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		if _, err := LoadKeyring(configs.EncryptionConfig{}); err == nil {
+			t.Error("LoadKeyring() error = nil without key file and environment variable")
+		}
+	})
+}
+
+func TestReloadKeyring(t *testing.T) {
+	previous := currentKeyring()
+	t.Cleanup(func() { SetKeyring(previous) })
+
+	path := filepath.Join(t.TempDir(), "master.key")
+	k, err := LoadKeyring(configs.EncryptionConfig{KeyFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeyring(k)
+	encrypted, err := k.Encrypt([]byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟其他进程执行rotate-key
+	if _, err := AddKeyVersion(path); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := reloadKeyring(true)
+	if reloaded.CurrentVersion() != 2 {
+		t.Fatalf("reloadKeyring() current = %d, want 2", reloaded.CurrentVersion())
+	}
+	if got, err := reloaded.Decrypt(encrypted); err != nil || string(got) != "value" {
+		t.Errorf("Decrypt() after reload = %q, %v", got, err)
+	}
+	if again := reloadKeyring(true); again != reloaded {
+		t.Error("reloadKeyring() reloaded an unchanged key file")
+	}
+
+	SetKeyring(&Keyring{keys: k.keys, current: k.current, fromEnv: true})
+	if got := reloadKeyring(true); got.CurrentVersion() != 1 {
+		t.Errorf("reloadKeyring() reloaded a keyring from the environment, current = %d", got.CurrentVersion())
+	}
+}
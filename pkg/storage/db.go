@@ -1,11 +1,14 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/huyouba1/kde/pkg/storage/models"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // DB 封装了数据库操作
@@ -31,6 +34,11 @@ func NewDB(dbPath string) (*DB, error) {
 	return &DB{db: db}, nil
 }
 
+// WrapDB 使用已有的数据库连接创建DB，调用方负责迁移数据库表
+func WrapDB(db *gorm.DB) *DB {
+	return &DB{db: db}
+}
+
 // GetCluster 获取集群信息
 func (db *DB) GetCluster(id string) (*models.ClusterModel, error) {
 	var cluster models.ClusterModel
@@ -73,9 +81,33 @@ func (db *DB) DeleteCluster(id string) error {
 	return nil
 }
 
-// UpdateClusterInfo 更新集群信息
+// UpdateClusterStatus 更新集群状态、版本和节点数，不修改其他字段
+func (db *DB) UpdateClusterStatus(id string, status models.ClusterStatus, version string, nodeCount int) error {
+	err := db.db.Model(&models.ClusterModel{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":     status,
+		"version":    version,
+		"node_count": nodeCount,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update cluster status: %w", err)
+	}
+	return nil
+}
+
+// UpdateClusterInfo 更新集群信息，不存在时创建
 func (db *DB) UpdateClusterInfo(clusterID string, info *models.ClusterInfo) error {
 	info.ClusterID = clusterID
+	if info.ID == 0 {
+		var existing models.ClusterInfo
+		err := db.db.Select("id", "created_at").First(&existing, "cluster_id = ?", clusterID).Error
+		switch {
+		case err == nil:
+			info.ID = existing.ID
+			info.CreatedAt = existing.CreatedAt
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return fmt.Errorf("failed to get cluster info: %w", err)
+		}
+	}
 	if err := db.db.Save(info).Error; err != nil {
 		return fmt.Errorf("failed to update cluster info: %w", err)
 	}
@@ -90,3 +122,81 @@ func (db *DB) GetClusterInfo(clusterID string) (*models.ClusterInfo, error) {
 	}
 	return &info, nil
 }
+
+// SyncNodes 保存集群的节点清单，并删除清单中不存在的节点
+func (db *DB) SyncNodes(clusterID string, nodes []*models.NodeModel) error {
+	err := db.db.Transaction(func(tx *gorm.DB) error {
+		names := make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			node.ClusterID = clusterID
+			names = append(names, node.Name)
+
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "name"}, {Name: "cluster_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{
+					"status", "role", "ip", "version", "labels", "taints",
+					"capacity", "allocatable", "conditions", "updated_at", "deleted_at",
+				}),
+			}).Create(node).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		query := tx.Unscoped().Where("cluster_id = ?", clusterID)
+		if len(names) > 0 {
+			query = query.Where("name NOT IN ?", names)
+		}
+		return query.Delete(&models.NodeModel{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sync nodes: %w", err)
+	}
+	return nil
+}
+
+// ListNodes 获取集群的节点清单
+func (db *DB) ListNodes(clusterID string) ([]*models.NodeModel, error) {
+	var nodes []*models.NodeModel
+	if err := db.db.Where("cluster_id = ?", clusterID).Order("name ASC").Find(&nodes).Error; err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	return nodes, nil
+}
+
+// DeleteNodes 删除集群的所有节点
+func (db *DB) DeleteNodes(clusterID string) error {
+	if err := db.db.Unscoped().Where("cluster_id = ?", clusterID).Delete(&models.NodeModel{}).Error; err != nil {
+		return fmt.Errorf("failed to delete nodes: %w", err)
+	}
+	return nil
+}
+
+// CreateAuditLog 记录审计日志
+func (db *DB) CreateAuditLog(entry *models.AuditLog) error {
+	if err := db.db.Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to create audit log: %w", err)
+	}
+	return nil
+}
+
+// FinishAuditLog 记录审计操作的结果
+func (db *DB) FinishAuditLog(entry *models.AuditLog, opErr error) error {
+	now := time.Now()
+	entry.FinishedAt = &now
+	entry.Result = models.AuditSucceeded
+	if opErr != nil {
+		entry.Result = models.AuditFailed
+		entry.Error = opErr.Error()
+	}
+
+	err := db.db.Model(entry).Updates(map[string]interface{}{
+		"result":      entry.Result,
+		"error":       entry.Error,
+		"finished_at": entry.FinishedAt,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update audit log: %w", err)
+	}
+	return nil
+}
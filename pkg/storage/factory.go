@@ -30,6 +30,13 @@ func NewFactory(cfg *configs.Config) *Factory {
 		panic(fmt.Sprintf("初始化数据库失败: %v", err))
 	}
 
+	// 加载敏感字段加密使用的主密钥
+	keyring, err := LoadKeyring(cfg.Database.Encryption)
+	if err != nil {
+		panic(fmt.Sprintf("加载主密钥失败: %v", err))
+	}
+	SetKeyring(keyring)
+
 	// 自动迁移数据库模型
 	if err := autoMigrate(db); err != nil {
 		panic(fmt.Sprintf("数据库迁移失败: %v", err))
@@ -45,6 +52,14 @@ func (f *Factory) GetDB() *gorm.DB {
 	return f.db
 }
 
+// AutoMigrate 迁移其他包注册的数据库模型
+func (f *Factory) AutoMigrate(models ...interface{}) error {
+	if err := f.db.AutoMigrate(models...); err != nil {
+		return fmt.Errorf("数据库迁移失败: %v", err)
+	}
+	return nil
+}
+
 // Close 关闭数据库连接
 func (f *Factory) Close() error {
 	sqlDB, err := f.db.DB()
@@ -67,6 +82,8 @@ func initSQLite(cfg configs.SQLiteConfig) (*gorm.DB, error) {
 func autoMigrate(db *gorm.DB) error {
 	return db.AutoMigrate(
 		&models.ClusterModel{},
+		&models.ClusterInfo{},
 		&models.NodeModel{},
+		&models.AuditLog{},
 	)
 }
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditResult 审计操作的结果
+type AuditResult string
+
+const (
+	// AuditStarted 操作进行中
+	AuditStarted AuditResult = "started"
+	// AuditSucceeded 操作成功
+	AuditSucceeded AuditResult = "succeeded"
+	// AuditFailed 操作失败
+	AuditFailed AuditResult = "failed"
+)
+
+// AuditLog 审计日志，记录查看日志、exec等直接访问集群的操作
+type AuditLog struct {
+	ID         uint        `gorm:"primaryKey" json:"id"`
+	Action     string      `gorm:"index;not null" json:"action"`
+	ClusterID  string      `gorm:"index" json:"cluster_id"`
+	Namespace  string      `json:"namespace"`
+	Resource   string      `json:"resource"`
+	Detail     string      `gorm:"type:text" json:"detail"`
+	RemoteAddr string      `json:"remote_addr"`
+	UserAgent  string      `json:"user_agent"`
+	Result     AuditResult `gorm:"index" json:"result"`
+	Error      string      `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt  time.Time   `gorm:"index" json:"created_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+}
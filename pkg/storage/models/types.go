@@ -28,7 +28,7 @@ type ClusterModel struct {
 	Name        string         `gorm:"not null" json:"name"`
 	Description string         `json:"description"`
 	Status      ClusterStatus  `gorm:"not null" json:"status"`
-	KubeConfig  string         `gorm:"type:text;not null" json:"kubeconfig"`
+	KubeConfig  string         `gorm:"type:text;not null;serializer:encrypted" json:"-"`
 	APIServer   string         `gorm:"not null" json:"api_server"`
 	Version     string         `json:"version"`
 	NodeCount   int            `gorm:"default:0" json:"node_count"`
@@ -45,17 +45,28 @@ type NodeCondition struct {
 	Message string `json:"message"`
 }
 
+// NodeTaint 节点污点
+type NodeTaint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Effect string `json:"effect"`
+}
+
 // NodeModel 节点数据库模型
+// Labels、Taints、Capacity、Allocatable和Conditions以JSON保存
 type NodeModel struct {
-	Name       string         `gorm:"primaryKey" json:"name"`
-	ClusterID  string         `gorm:"primaryKey" json:"cluster_id"`
-	Status     string         `gorm:"not null" json:"status"`
-	Role       string         `gorm:"not null" json:"role"`
-	IP         string         `gorm:"not null" json:"ip"`
-	Version    string         `json:"version"`
-	Labels     string         `gorm:"type:text" json:"labels"`
-	Conditions string         `gorm:"type:text" json:"conditions"`
-	CreatedAt  time.Time      `gorm:"not null" json:"created_at"`
-	UpdatedAt  time.Time      `gorm:"not null" json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	Name        string         `gorm:"primaryKey" json:"name"`
+	ClusterID   string         `gorm:"primaryKey" json:"cluster_id"`
+	Status      string         `gorm:"not null" json:"status"`
+	Role        string         `gorm:"not null" json:"role"`
+	IP          string         `gorm:"not null" json:"ip"`
+	Version     string         `json:"version"`
+	Labels      string         `gorm:"type:text" json:"labels"`
+	Taints      string         `gorm:"type:text" json:"taints"`
+	Capacity    string         `gorm:"type:text" json:"capacity"`
+	Allocatable string         `gorm:"type:text" json:"allocatable"`
+	Conditions  string         `gorm:"type:text" json:"conditions"`
+	CreatedAt   time.Time      `gorm:"not null" json:"created_at"`
+	UpdatedAt   time.Time      `gorm:"not null" json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 }
@@ -1,9 +1,12 @@
 package sqlite
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/huyouba1/kde/pkg/cluster"
+	"github.com/huyouba1/kde/pkg/storage/models"
 	"gorm.io/gorm"
 )
 
@@ -23,16 +26,19 @@ type ClusterModel struct {
 
 // NodeModel 节点数据库模型
 type NodeModel struct {
-	Name       string `gorm:"primaryKey"`
-	ClusterID  string `gorm:"primaryKey"`
-	Status     string `gorm:"not null"`
-	Role       string `gorm:"not null"`
-	IP         string `gorm:"not null"`
-	Version    string
-	Labels     string    `gorm:"type:text"`
-	Conditions string    `gorm:"type:text"`
-	CreatedAt  time.Time `gorm:"not null"`
-	UpdatedAt  time.Time `gorm:"not null"`
+	Name        string `gorm:"primaryKey"`
+	ClusterID   string `gorm:"primaryKey"`
+	Status      string `gorm:"not null"`
+	Role        string `gorm:"not null"`
+	IP          string `gorm:"not null"`
+	Version     string
+	Labels      string    `gorm:"type:text"`
+	Taints      string    `gorm:"type:text"`
+	Capacity    string    `gorm:"type:text"`
+	Allocatable string    `gorm:"type:text"`
+	Conditions  string    `gorm:"type:text"`
+	CreatedAt   time.Time `gorm:"not null"`
+	UpdatedAt   time.Time `gorm:"not null"`
 }
 
 // ToCluster 转换为集群对象
@@ -41,7 +47,7 @@ func (m *ClusterModel) ToCluster() *cluster.Cluster {
 		ID:          m.ID,
 		Name:        m.Name,
 		Description: m.Description,
-		Status:      cluster.ClusterStatus(m.Status),
+		Status:      models.ClusterStatus(m.Status),
 		KubeConfig:  m.KubeConfig,
 		APIServer:   m.APIServer,
 		Version:     m.Version,
@@ -68,33 +74,73 @@ func FromCluster(c *cluster.Cluster) *ClusterModel {
 }
 
 // ToNode 转换为节点对象
-func (m *NodeModel) ToNode() *cluster.Node {
-	return &cluster.Node{
-		Name:       m.Name,
-		ClusterID:  m.ClusterID,
-		Status:     m.Status,
-		Role:       m.Role,
-		IP:         m.IP,
-		Version:    m.Version,
-		Labels:     make(map[string]string),          // TODO: 实现 JSON 解析
-		Conditions: make([]cluster.NodeCondition, 0), // TODO: 实现 JSON 解析
+func (m *NodeModel) ToNode() (*cluster.Node, error) {
+	node := &cluster.Node{
+		Name:      m.Name,
+		ClusterID: m.ClusterID,
+		Status:    m.Status,
+		Role:      m.Role,
+		IP:        m.IP,
+		Version:   m.Version,
+		UpdatedAt: m.UpdatedAt,
+	}
+
+	fields := []struct {
+		name  string
+		value string
+		dst   interface{}
+	}{
+		{"labels", m.Labels, &node.Labels},
+		{"taints", m.Taints, &node.Taints},
+		{"capacity", m.Capacity, &node.Capacity},
+		{"allocatable", m.Allocatable, &node.Allocatable},
+		{"conditions", m.Conditions, &node.Conditions},
 	}
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(field.value), field.dst); err != nil {
+			return nil, fmt.Errorf("解析节点 %s 的 %s 失败: %v", m.Name, field.name, err)
+		}
+	}
+
+	return node, nil
 }
 
 // FromNode 从节点对象创建模型
-func FromNode(n *cluster.Node) *NodeModel {
-	return &NodeModel{
-		Name:       n.Name,
-		ClusterID:  n.ClusterID,
-		Status:     n.Status,
-		Role:       n.Role,
-		IP:         n.IP,
-		Version:    n.Version,
-		Labels:     "", // TODO: 实现 JSON 序列化
-		Conditions: "", // TODO: 实现 JSON 序列化
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
+func FromNode(n *cluster.Node) (*NodeModel, error) {
+	m := &NodeModel{
+		Name:      n.Name,
+		ClusterID: n.ClusterID,
+		Status:    n.Status,
+		Role:      n.Role,
+		IP:        n.IP,
+		Version:   n.Version,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	fields := []struct {
+		name  string
+		value interface{}
+		dst   *string
+	}{
+		{"labels", n.Labels, &m.Labels},
+		{"taints", n.Taints, &m.Taints},
+		{"capacity", n.Capacity, &m.Capacity},
+		{"allocatable", n.Allocatable, &m.Allocatable},
+		{"conditions", n.Conditions, &m.Conditions},
+	}
+	for _, field := range fields {
+		data, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, fmt.Errorf("序列化节点 %s 的 %s 失败: %v", n.Name, field.name, err)
+		}
+		*field.dst = string(data)
 	}
+
+	return m, nil
 }
 
 // AutoMigrate 自动迁移数据库模型